@@ -0,0 +1,217 @@
+package main
+
+import "bytes"
+import "errors"
+import "fmt"
+import "os"
+import "strings"
+import "github.com/btcsuite/btcutil/base58"
+import "github.com/btcsuite/btcd/btcutil/bech32"
+
+// Addresses are bech32 strings: a network prefix, then the address type
+// and its program. Type 0 uses the bech32 checksum, later types bech32m,
+// as segwit does. Base58 addresses from before still decode on mainnet.
+
+type Network struct {
+	Name string
+	HRP  string
+}
+
+var MainNet = &Network{"mainnet", "nfc"}
+var TestNet = &Network{"testnet", "tnfc"}
+var RegTest = &Network{"regtest", "nfcrt"}
+
+var networks = []*Network{MainNet, TestNet, RegTest}
+
+// ActiveNetwork is set from the -network flag.
+var ActiveNetwork = MainNet
+
+type AddressType byte
+
+const (
+	// pays to HashPubKey of a versioned public key
+	PubKeyHashAddress AddressType = 0
+	// reserved, outputs can't be locked to these yet
+	ScriptHashAddress AddressType = 1
+	TaprootAddress    AddressType = 2
+)
+
+var addressProgramLen = map[AddressType]int{
+	PubKeyHashAddress: pubKeyHashLen,
+	ScriptHashAddress: 32,
+	TaprootAddress:    32,
+}
+
+var errUnknownNetwork = errors.New("unknown network")
+var errAddressNetwork = errors.New("address belongs to another network")
+var errAddressLength = errors.New("address has the wrong length")
+var errAddressVersion = errors.New("address has an unknown version")
+var errAddressChecksum = errors.New("address checksum doesn't match")
+var errLegacyAddress = errors.New("base58 addresses are only valid on mainnet")
+var errUnsupportedAddress = errors.New("outputs can't pay to this address type yet")
+
+// a legacy address is version(1) | pubkey hash(20) | checksum(4) in base58
+const (
+	pubKeyHashLen   = 20
+	addressChecksum = 4
+	addressLen      = 1 + pubKeyHashLen + addressChecksum
+)
+
+type Address struct {
+	Type    AddressType
+	Program []byte
+	Network *Network
+	// the base58 version byte, 0 for bech32 addresses
+	LegacyVersion byte
+}
+
+func GetNetwork(name string) (*Network, error) {
+	for _, network := range networks {
+		if network.Name == name {
+			return network, nil
+		}
+	}
+	return nil, errUnknownNetwork
+}
+
+func NewPubKeyHashAddress(pubKeyHash []byte) *Address {
+	return &Address{PubKeyHashAddress, pubKeyHash, ActiveNetwork, 0}
+}
+
+func (a *Address) String() string {
+	if a.LegacyVersion != 0 {
+		return encodeLegacyAddress(a.LegacyVersion, a.Program)
+	}
+
+	program, _ := bech32.ConvertBits(a.Program, 8, 5, true)
+	data := append([]byte{byte(a.Type)}, program...)
+
+	encoded := ""
+	if a.Type == PubKeyHashAddress {
+		encoded, _ = bech32.Encode(a.Network.HRP, data)
+	} else {
+		encoded, _ = bech32.EncodeM(a.Network.HRP, data)
+	}
+
+	return encoded
+}
+
+// PubKeyHash returns the pubkey hash outputs to this address lock to.
+func (a *Address) PubKeyHash() ([]byte, error) {
+	if a.Type != PubKeyHashAddress {
+		return nil, errUnsupportedAddress
+	}
+	return a.Program, nil
+}
+
+// DecodeAddress decodes an address of the active network.
+func DecodeAddress(address string) (*Address, error) {
+	lower := strings.ToLower(address)
+
+	for _, network := range networks {
+		if !strings.HasPrefix(lower, network.HRP+"1") {
+			continue
+		}
+
+		decoded, err := decodeBech32Address(address)
+		if err != nil {
+			return nil, err
+		}
+		if decoded.Network != ActiveNetwork {
+			return nil, errAddressNetwork
+		}
+		return decoded, nil
+	}
+
+	decoded, err := decodeLegacyAddress(address)
+	if err == nil && ActiveNetwork != MainNet {
+		return nil, errLegacyAddress
+	}
+
+	return decoded, err
+}
+
+func decodeBech32Address(address string) (*Address, error) {
+	hrp, data, variant, err := bech32.DecodeGeneric(address)
+	if err != nil || len(data) == 0 {
+		return nil, errAddressChecksum
+	}
+
+	var network *Network
+	for _, n := range networks {
+		if n.HRP == hrp {
+			network = n
+		}
+	}
+	if network == nil {
+		return nil, errUnknownNetwork
+	}
+
+	addressType := AddressType(data[0])
+	programLen, ok := addressProgramLen[addressType]
+	if !ok {
+		return nil, errAddressVersion
+	}
+
+	if (addressType == PubKeyHashAddress) != (variant == bech32.Version0) {
+		return nil, errAddressChecksum
+	}
+
+	program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil || len(program) != programLen {
+		return nil, errAddressLength
+	}
+
+	return &Address{addressType, program, network, 0}, nil
+}
+
+func encodeLegacyAddress(version byte, pubKeyHash []byte) string {
+	versionedPayload := append([]byte{version}, pubKeyHash...)
+	checksum := checksum(versionedPayload)
+
+	fullPayload := append(versionedPayload, checksum...)
+
+	return base58.Encode(fullPayload)
+}
+
+func decodeLegacyAddress(address string) (*Address, error) {
+	decoded := base58.Decode(address)
+	if len(decoded) != addressLen {
+		return nil, errAddressLength
+	}
+
+	if _, err := GetSignatureScheme(decoded[0]); err != nil {
+		return nil, errAddressVersion
+	}
+
+	payload := decoded[:addressLen-addressChecksum]
+	if !bytes.Equal(checksum(payload), decoded[addressLen-addressChecksum:]) {
+		return nil, errAddressChecksum
+	}
+
+	return &Address{PubKeyHashAddress, payload[1:], MainNet, decoded[0]}, nil
+}
+
+// ValidateAddress checks that address decodes on the active network.
+func ValidateAddress(address string) error {
+	_, err := DecodeAddress(address)
+
+	return err
+}
+
+// AddressPubKeyHash exits when address can't be paid to, rather than
+// paying to a garbage hash.
+func AddressPubKeyHash(address string) []byte {
+	decoded, err := DecodeAddress(address)
+	if err == nil {
+		var pubKeyHash []byte
+		if pubKeyHash, err = decoded.PubKeyHash(); err == nil {
+			return pubKeyHash
+		}
+	}
+
+	fmt.Printf("invalid address %q: %s\n", address, err)
+	os.Exit(1)
+
+	return nil
+}
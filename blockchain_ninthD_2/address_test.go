@@ -0,0 +1,132 @@
+package main
+
+import "testing"
+import "bytes"
+import "strings"
+import "github.com/btcsuite/btcutil/base58"
+import "github.com/btcsuite/btcd/btcutil/bech32"
+
+func TestDecodeLegacyAddress(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{0x42}, pubKeyHashLen)
+	good := encodeLegacyAddress(VersionP256, pubKeyHash)
+	decoded := base58.Decode(good)
+
+	badChecksum := append([]byte{}, decoded...)
+	badChecksum[len(badChecksum)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		address string
+		err     error
+	}{
+		{"valid", good, nil},
+		{"empty", "", errAddressLength},
+		{"short hash", encodeLegacyAddress(VersionP256, pubKeyHash[1:]), errAddressLength},
+		{"long hash", encodeLegacyAddress(VersionP256, append(pubKeyHash, 0x42)), errAddressLength},
+		{"not base58", "0OIl" + good[4:], errAddressLength},
+		{"unknown version", encodeLegacyAddress(0x7f, pubKeyHash), errAddressVersion},
+		{"bad checksum", base58.Encode(badChecksum), errAddressChecksum},
+	}
+
+	for _, test := range tests {
+		if err := ValidateAddress(test.address); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	if got := AddressPubKeyHash(good); !bytes.Equal(got, pubKeyHash) {
+		t.Errorf("pubkey hash %x, want %x", got, pubKeyHash)
+	}
+
+	ActiveNetwork = TestNet
+	defer func() { ActiveNetwork = MainNet }()
+	if err := ValidateAddress(good); err != errLegacyAddress {
+		t.Errorf("on testnet: got %v, want %v", err, errLegacyAddress)
+	}
+}
+
+// type 0 addresses must use the bech32 checksum and later types bech32m,
+// these are the valid strings of BIP 173 and BIP 350
+func TestBech32ChecksumVectors(t *testing.T) {
+	tests := []struct {
+		encoded string
+		variant bech32.Version
+	}{
+		{"A12UEL5L", bech32.Version0},
+		{"a12uel5l", bech32.Version0},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", bech32.Version0},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", bech32.Version0},
+		{"?1ezyfcl", bech32.Version0},
+		{"A1LQFN3A", bech32.VersionM},
+		{"a1lqfn3a", bech32.VersionM},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", bech32.VersionM},
+		{"?1v759aa", bech32.VersionM},
+	}
+
+	for _, test := range tests {
+		_, _, variant, err := bech32.DecodeGeneric(test.encoded)
+		if err != nil || variant != test.variant {
+			t.Errorf("%s: variant %v, %v, want %v", test.encoded, variant, err, test.variant)
+		}
+	}
+
+	// checksum over the uppercase prefix, separator too close to the end,
+	// empty prefix, mixed case
+	for _, encoded := range []string{"A1G7SGD8", "li1dgmt3", "1pzry9x0s0muk", "A1LQfN3A"} {
+		if _, _, _, err := bech32.DecodeGeneric(encoded); err == nil {
+			t.Errorf("%s: decoded", encoded)
+		}
+	}
+}
+
+func TestDecodeBech32Address(t *testing.T) {
+	pubKeyHash := []byte{}
+	program := []byte{}
+	for i := 0; i < 32; i++ {
+		if i < pubKeyHashLen {
+			pubKeyHash = append(pubKeyHash, byte(i))
+		}
+		program = append(program, byte(i))
+	}
+
+	pkhAddress := "nfc1qqqqsyqcyq5rqwzqfpg9scrgwpugpzysnpre54p"
+	taprootAddress := "nfc1zqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0sj02sal"
+
+	if got := NewPubKeyHashAddress(pubKeyHash).String(); got != pkhAddress {
+		t.Errorf("pubkey hash address %s, want %s", got, pkhAddress)
+	}
+	if got := (&Address{TaprootAddress, program, MainNet, 0}).String(); got != taprootAddress {
+		t.Errorf("taproot address %s, want %s", got, taprootAddress)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		err     error
+	}{
+		{"pubkey hash", pkhAddress, nil},
+		{"uppercase", "NFC1QQQQSYQCYQ5RQWZQFPG9SCRGWPUGPZYSNPRE54P", nil},
+		{"taproot", taprootAddress, nil},
+		{"mixed case", "nfc1QQQQsyqcyq5rqwzqfpg9scrgwpugpzysnpre54p", errAddressChecksum},
+		{"bad checksum", pkhAddress[:len(pkhAddress)-1] + "q", errAddressChecksum},
+		{"type 0 with bech32m", "nfc1qqqqsyqcyq5rqwzqfpg9scrgwpugpzysn5lfcsr", errAddressChecksum},
+		{"type 2 with bech32", "nfc1zqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0s8n6uca", errAddressChecksum},
+		{"testnet prefix", "tnfc1zqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0seqwwz2", errAddressNetwork},
+		{"other prefix", "bc1qqqqsyqcyq5rqwzqfpg9scrgwpugpzysnpre54p", errAddressLength},
+	}
+
+	for _, test := range tests {
+		decoded, err := DecodeAddress(test.address)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && decoded.String() != strings.ToLower(test.address) {
+			t.Errorf("%s: encodes back to %s", test.name, decoded.String())
+		}
+	}
+
+	if _, err := (&Address{TaprootAddress, program, MainNet, 0}).PubKeyHash(); err != errUnsupportedAddress {
+		t.Errorf("taproot pubkey hash: got %v, want %v", err, errUnsupportedAddress)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import "errors"
+import "strconv"
+import "strings"
+
+// Amount counts base units, a coin is worth Coin of them. The CLI takes
+// and prints amounts as decimal coins, "1.5" is 150000000 base units.
+type Amount int64
+
+const CoinDecimals = 8
+const Coin Amount = 100000000
+
+// no output, nor the outputs of a transaction together, can be worth more
+const MaxMoney = 21000000 * Coin
+
+var errBadAmount = errors.New("amounts are decimal coins with at most 8 decimals, like 1.5")
+var errNegativeAmount = errors.New("amounts can't be negative")
+var errAmountOverflow = errors.New("amount is more than the max money")
+
+// Add returns a+b, an error when it is negative or more than MaxMoney.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a < 0 || b < 0 {
+		return 0, errNegativeAmount
+	}
+	if a > MaxMoney || b > MaxMoney-a {
+		return 0, errAmountOverflow
+	}
+	return a + b, nil
+}
+
+// Sub returns a-b, an error when it is negative.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if a < 0 || b < 0 || b > a {
+		return 0, errNegativeAmount
+	}
+	return a - b, nil
+}
+
+// SumAmounts adds amounts up with Add.
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var sum Amount
+	for _, amount := range amounts {
+		var err error
+		if sum, err = sum.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// ParseAmount parses decimal coins, "20", "1.5" or "0.00000001", into
+// base units.
+func ParseAmount(s string) (Amount, error) {
+	if strings.HasPrefix(s, "-") {
+		return 0, errNegativeAmount
+	}
+
+	whole, frac := s, ""
+	if dot := strings.Index(s, "."); dot >= 0 {
+		whole, frac = s[:dot], s[dot+1:]
+	}
+	if whole == "" && frac == "" || len(frac) > CoinDecimals || !isDigits(whole) || !isDigits(frac) {
+		return 0, errBadAmount
+	}
+
+	var amount Amount
+	if whole != "" {
+		coins, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || Amount(coins) > MaxMoney/Coin {
+			return 0, errAmountOverflow
+		}
+		amount = Amount(coins) * Coin
+	}
+
+	if frac != "" {
+		units, _ := strconv.ParseInt(frac+strings.Repeat("0", CoinDecimals-len(frac)), 10, 64)
+		amount += Amount(units)
+	}
+
+	if amount > MaxMoney {
+		return 0, errAmountOverflow
+	}
+
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats a as decimal coins without trailing zeros.
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-a)
+	}
+
+	s := sign + strconv.FormatUint(units/uint64(Coin), 10)
+
+	frac := strconv.FormatUint(units%uint64(Coin), 10)
+	if frac != "0" {
+		frac = strings.Repeat("0", CoinDecimals-len(frac)) + frac
+		s += "." + strings.TrimRight(frac, "0")
+	}
+
+	return s
+}
+
+// SignedString is String with a + in front of amounts above 0.
+func (a Amount) SignedString() string {
+	if a > 0 {
+		return "+" + a.String()
+	}
+	return a.String()
+}
+
+// MarshalJSON writes a as a number of coins, 1.5 rather than 150000000.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
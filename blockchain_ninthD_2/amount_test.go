@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s      string
+		amount Amount
+		err    error
+	}{
+		{"0", 0, nil},
+		{"1", Coin, nil},
+		{"1.5", 150000000, nil},
+		{".5", 50000000, nil},
+		{"5.", 5 * Coin, nil},
+		{"007", 7 * Coin, nil},
+		{"20.10", 2010000000, nil},
+		{"0.00000001", 1, nil},
+		{"21000000", MaxMoney, nil},
+		{"", 0, errBadAmount},
+		{".", 0, errBadAmount},
+		{"-", 0, errNegativeAmount},
+		{"-5", 0, errNegativeAmount},
+		{"+1", 0, errBadAmount},
+		{" 1", 0, errBadAmount},
+		{"1e5", 0, errBadAmount},
+		{"abc", 0, errBadAmount},
+		{"1.2.3", 0, errBadAmount},
+		{"1.000000001", 0, errBadAmount},
+		{"0.123456789", 0, errBadAmount},
+		{"21000000.00000001", 0, errAmountOverflow},
+		{"21000001", 0, errAmountOverflow},
+		{"99999999999999999999", 0, errAmountOverflow},
+	}
+
+	for _, test := range tests {
+		amount, err := ParseAmount(test.s)
+		if amount != test.amount || err != test.err {
+			t.Errorf("%q: got %d, %v, want %d, %v", test.s, int64(amount), err, int64(test.amount), test.err)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		s      string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{Coin, "1"},
+		{150000000, "1.5"},
+		{2010000000, "20.1"},
+		{MaxMoney - 1, "20999999.99999999"},
+		{MaxMoney, "21000000"},
+		{-150000000, "-1.5"},
+	}
+
+	for _, test := range tests {
+		if s := test.amount.String(); s != test.s {
+			t.Errorf("%d: got %q, want %q", int64(test.amount), s, test.s)
+		}
+		if test.amount < 0 {
+			continue
+		}
+		if amount, err := ParseAmount(test.s); amount != test.amount || err != nil {
+			t.Errorf("%q parses back to %d, %v", test.s, int64(amount), err)
+		}
+	}
+
+	if s := Amount(5).SignedString(); s != "+0.00000005" {
+		t.Errorf("signed 5: got %q", s)
+	}
+	if s := Amount(0).SignedString(); s != "0" {
+		t.Errorf("signed 0: got %q", s)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	if sum, err := (MaxMoney - 1).Add(1); sum != MaxMoney || err != nil {
+		t.Errorf("up to max money: got %d, %v", int64(sum), err)
+	}
+	if _, err := MaxMoney.Add(1); err != errAmountOverflow {
+		t.Errorf("past max money: got %v, want %v", err, errAmountOverflow)
+	}
+	if _, err := Amount(1).Add(-1); err != errNegativeAmount {
+		t.Errorf("adding a negative amount: got %v, want %v", err, errNegativeAmount)
+	}
+	if _, err := Amount(1).Sub(2); err != errNegativeAmount {
+		t.Errorf("below 0: got %v, want %v", err, errNegativeAmount)
+	}
+	if _, err := SumAmounts(MaxMoney, MaxMoney); err != errAmountOverflow {
+		t.Errorf("sum past max money: got %v, want %v", err, errAmountOverflow)
+	}
+	if sum, err := SumAmounts(Coin, 2*Coin, 1); sum != 3*Coin+1 || err != nil {
+		t.Errorf("sum: got %d, %v", int64(sum), err)
+	}
+}
@@ -1,19 +1,19 @@
 package main
 
 import "bytes"
+import "context"
 import "crypto/sha256"
 import "time"
 import "strconv"
 import "encoding/gob"
 import "math/rand"
 
+const TargetBits = 252
+
 type Block struct {
-	Timestamp    int64
+	Header       BlockHeader
 	Transactions []*Transaction
-	PreBlockHash []byte
 	Hash         []byte
-	Targetbits   uint
-	Nonce        int
 }
 
 func (block *Block) SerializeBlock() []byte {
@@ -37,27 +37,32 @@ func DeSerializeBlock(buffer []byte) *Block {
 }
 
 func NewBlock(transactions []*Transaction, preBlockHash []byte) *Block {
-	b := &Block{time.Now().Unix(), transactions, preBlockHash, []byte{}, 252, 0}
-
-	pow := NewProofOfWork(b)
-	nonce, hash := pow.Run()
-
-	b.Nonce = nonce
-	b.Hash = hash[:]
+	b, _, _ := NewBlockContext(context.Background(), transactions, preBlockHash)
 
 	return b
 }
 
-func (b *Block) HashTransaction() []byte {
-	var txHashes [][]byte
-	var txHash [32]byte
+// NewBlockContext mines a new block and returns it with the hashes per
+// second it took, it gives up with ctx.Err() once ctx is cancelled.
+// Transactions breaking a consensus rule aren't mined.
+func NewBlockContext(ctx context.Context, transactions []*Transaction, preBlockHash []byte) (*Block, float64, error) {
+	if err := CheckBlockTransactions(transactions); err != nil {
+		return nil, 0, err
+	}
+
+	header := NewBlockHeader(transactions, preBlockHash, TargetBits, uint32(time.Now().Unix()))
+	b := &Block{header, transactions, []byte{}}
 
-	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.ID)
+	pow := NewProofOfWork(b)
+	nonce, hash, err := pow.RunContext(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
 
-	return txHash[:]
+	b.Header.Nonce = nonce
+	b.Hash = hash[:]
+
+	return b, pow.Hashrate(), nil
 }
 
 func (tx *Transaction) SetID() {
@@ -0,0 +1,70 @@
+package main
+
+import "crypto/sha256"
+import "encoding/binary"
+
+const BlockVersion = 1
+
+// BlockHeaderSize is the length of a serialized BlockHeader:
+// version(4) | prev hash(32) | merkle root(32) | time(4) | bits(4) | nonce(4)
+const BlockHeaderSize = 80
+
+// the nonce is the last field, the miner only rewrites these 4 bytes
+const headerNonceOffset = BlockHeaderSize - 4
+
+type BlockHeader struct {
+	Version       int32
+	PrevBlockHash [32]byte
+	MerkleRoot    [32]byte
+	Time          uint32
+	Bits          uint32
+	Nonce         uint32
+}
+
+func NewBlockHeader(transactions []*Transaction, preBlockHash []byte, bits uint32, timestamp uint32) BlockHeader {
+	header := BlockHeader{Version: BlockVersion, Time: timestamp, Bits: bits}
+
+	copy(header.PrevBlockHash[:], preBlockHash)
+	copy(header.MerkleRoot[:], MerkleRoot(transactions))
+
+	return header
+}
+
+// Serialize returns the fixed size little endian layout of the header,
+// this is the only data proof of work is computed over.
+func (h *BlockHeader) Serialize() []byte {
+	data := make([]byte, BlockHeaderSize)
+
+	binary.LittleEndian.PutUint32(data[0:4], uint32(h.Version))
+	copy(data[4:36], h.PrevBlockHash[:])
+	copy(data[36:68], h.MerkleRoot[:])
+	binary.LittleEndian.PutUint32(data[68:72], h.Time)
+	binary.LittleEndian.PutUint32(data[72:76], h.Bits)
+	binary.LittleEndian.PutUint32(data[76:80], h.Nonce)
+
+	return data
+}
+
+func DeserializeBlockHeader(data []byte) BlockHeader {
+	var h BlockHeader
+
+	h.Version = int32(binary.LittleEndian.Uint32(data[0:4]))
+	copy(h.PrevBlockHash[:], data[4:36])
+	copy(h.MerkleRoot[:], data[36:68])
+	h.Time = binary.LittleEndian.Uint32(data[68:72])
+	h.Bits = binary.LittleEndian.Uint32(data[72:76])
+	h.Nonce = binary.LittleEndian.Uint32(data[76:80])
+
+	return h
+}
+
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+// HasParent is false for the genesis header, whose prev hash is all zero.
+func (h *BlockHeader) HasParent() bool {
+	return h.PrevBlockHash != [32]byte{}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+import "bytes"
+import "encoding/hex"
+
+func TestBlockHeaderSerialize(t *testing.T) {
+	header := BlockHeader{Version: 1, Time: 0x5f5e1000, Bits: 0x1d00ffff, Nonce: 0xdeadbeef}
+	for i := range header.PrevBlockHash {
+		header.PrevBlockHash[i] = 0xaa
+		header.MerkleRoot[i] = 0xbb
+	}
+
+	data := header.Serialize()
+	if len(data) != BlockHeaderSize {
+		t.Fatalf("%d bytes, want %d", len(data), BlockHeaderSize)
+	}
+
+	fields := []struct {
+		name  string
+		start int
+		value string
+	}{
+		{"version", 0, "01000000"},
+		{"prev hash", 4, hex.EncodeToString(bytes.Repeat([]byte{0xaa}, 32))},
+		{"merkle root", 36, hex.EncodeToString(bytes.Repeat([]byte{0xbb}, 32))},
+		{"time", 68, "00105e5f"},
+		{"bits", 72, "ffff001d"},
+		{"nonce", headerNonceOffset, "efbeadde"},
+	}
+	for _, field := range fields {
+		end := field.start + len(field.value)/2
+		if got := hex.EncodeToString(data[field.start:end]); got != field.value {
+			t.Errorf("%s at %d: %s, want %s", field.name, field.start, got, field.value)
+		}
+	}
+
+	if headerNonceOffset != 76 {
+		t.Errorf("nonce offset %d, want 76", headerNonceOffset)
+	}
+	if got := DeserializeBlockHeader(data); got != header {
+		t.Errorf("round trip gives %+v, want %+v", got, header)
+	}
+}
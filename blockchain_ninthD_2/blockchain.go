@@ -1,10 +1,46 @@
 package main
 
 import "fmt"
+import "bytes"
+import "context"
+import "errors"
 import "os"
 import "time"
 import "github.com/boltdb/bolt"
 import "encoding/hex"
+import "crypto/sha256"
+
+// the layout blocks are stored in, kept next to the tip. Chains written
+// before block headers, or before amounts were counted in base units, have
+// none: they can't be read, the old values are in the hashes and signed.
+const chainFormatKey = "format"
+const chainFormat byte = 1
+
+var errChainFormat = errors.New("the chain file was written by an older version, move it away to start a new chain")
+
+// a process holds the chain file locked while it has it open, the others
+// wait for it at most chainLockTimeout
+const chainFile = "NFC_chain"
+const chainLockTimeout = 10 * time.Second
+
+var errChainLocked = errors.New("the chain is used by another process, try again later")
+var errChainNetwork = errors.New("the chain file belongs to another network")
+var errChainMoved = errors.New("the chain was extended by another process while mining")
+
+func openChain(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(chainFile, 0600, &bolt.Options{Timeout: chainLockTimeout, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, errChainLocked
+	}
+	return db, err
+}
+
+func checkChainFormat(b *bolt.Bucket) error {
+	if !bytes.Equal(b.Get([]byte(chainFormatKey)), []byte{chainFormat}) {
+		return errChainFormat
+	}
+	return nil
+}
 
 type BlockChain struct {
 	//blocks []*Block
@@ -12,115 +48,269 @@ type BlockChain struct {
 	db  *bolt.DB
 }
 
-func NewBlockChain(rewardAddr string) *BlockChain {
+// NewBlockChain opens the chain file, a new one starts from the genesis
+// block of the active network.
+func NewBlockChain() *BlockChain {
 	var tip []byte
-	dbFile := "NFC_chain"
 
-	db, _ := bolt.Open(dbFile, 0600, nil)
+	genesis := NewGenesis(ActiveNetwork)
+
+	db, err := openChain(false)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
 
-	_ = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 
 		if b == nil {
-			coinbase := NewCoinbaseTx(rewardAddr, "")
-
-			genesis := NewGenesis(coinbase)
-
 			b, _ := tx.CreateBucket([]byte(blocksBucket))
 
 			_ = b.Put(genesis.Hash, genesis.SerializeBlock())
 
 			_ = b.Put([]byte("l"), genesis.Hash)
+			_ = b.Put([]byte(chainFormatKey), []byte{chainFormat})
 			tip = genesis.Hash
+
+			headers, _ := tx.CreateBucket([]byte(headersBucket))
+			_ = indexHeader(headers, genesis.Header)
+
+			_ = putBlockFilter(tx, genesis)
 		} else {
-			tip = b.Get([]byte("l"))
+			if err := checkChainFormat(b); err != nil {
+				return err
+			}
+			if b.Get(genesis.Hash) == nil {
+				return errChainNetwork
+			}
+			// a copy, what Get returns is gone once the file is closed
+			tip = append(tip, b.Get([]byte("l"))...)
 		}
 		return nil
 	})
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
 
 	bc := BlockChain{tip, db}
+	bc.IndexHeaders()
+	bc.IndexFilters()
 
 	return &bc
 }
 
+// Close releases the chain file for other processes.
+func (bc *BlockChain) Close() error {
+	return bc.db.Close()
+}
+
+// Reopen opens the chain file again after Close, with the tip another
+// process may have written in between.
+func (bc *BlockChain) Reopen() error {
+	db, err := openChain(false)
+	if err != nil {
+		return err
+	}
+	bc.db = db
+
+	bc.tip = bc.ReadTip()
+	return nil
+}
+
 func (bc *BlockChain) AddBlock(transactions []*Transaction) *Block {
-	newBlock := NewBlock(transactions, bc.tip)
+	newBlock, _, _ := bc.AddBlockContext(context.Background(), transactions)
+
+	return newBlock
+}
 
-	pow := NewProofOfWork(newBlock)
+// AddBlockContext mines transactions on the tip, see NewBlockContext. The
+// chain file is released while mining, errChainMoved is returned if
+// another process extended the chain meanwhile.
+func (bc *BlockChain) AddBlockContext(ctx context.Context, transactions []*Transaction) (*Block, float64, error) {
+	if err := bc.CheckNewTransactions(transactions); err != nil {
+		return nil, 0, err
+	}
 
-	nonce, hash := pow.Run()
+	tip := bc.tip
+	bc.Close()
 
-	pow.block.Nonce = nonce
-	pow.block.Hash = hash[:]
+	newBlock, hashrate, err := NewBlockContext(ctx, transactions, tip)
+	if reopenErr := bc.Reopen(); reopenErr != nil {
+		return nil, 0, reopenErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(bc.tip, tip) {
+		return nil, 0, errChainMoved
+	}
 
 	_ = bc.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 
-		_ = b.Put(pow.block.Hash, pow.block.SerializeBlock())
+		_ = b.Put(newBlock.Hash, newBlock.SerializeBlock())
 
-		_ = b.Put([]byte("l"), pow.block.Hash)
+		_ = b.Put([]byte("l"), newBlock.Hash)
 
-		bc.tip = pow.block.Hash
+		bc.tip = newBlock.Hash
 
-		return nil
+		if err := indexHeader(tx.Bucket([]byte(headersBucket)), newBlock.Header); err != nil {
+			return err
+		}
+
+		return putBlockFilter(tx, newBlock)
 	})
 
-	return newBlock
+	return newBlock, hashrate, nil
+}
+
+const GenesisTargetBits = 253
+
+// the genesis reward goes, on every network, to this key of the committed
+// wallet. It is a legacy key, see VersionLegacyP256.
+const genesisAddress = "LkGGzXxTNqvqVp34mgjrbz1qxuJ7yo9svg"
+
+// every node of a network starts from the same genesis block, or their
+// chains would share no block to sync from. Nothing of it is mined: the
+// time and nonce are fixed, and the hash they give is checked.
+type genesisParams struct {
+	Time  uint32
+	Nonce uint32
+	Hash  string
+}
+
+var genesisBlocks = map[*Network]genesisParams{
+	MainNet: {1760000000, 6, "06a8d3a5549571f22c3e9a058022454555d645a793b824a5f3ddcc49b4a23f7f"},
+	TestNet: {1760000000, 12, "17492d5c96e9c805dac79781cb7d3b9179d5348f1e9d92d51ce76f2b5cd8dc59"},
+	RegTest: {1760000000, 11, "128f4092b5e5c85d1617ff55ed5f6051057b949364a29aaac8351a243b77a2f3"},
 }
 
-func NewGenesis(coinbase *Transaction) *Block {
-	b := &Block{time.Now().Unix(), []*Transaction{coinbase}, []byte{}, []byte{}, 253, 0}
+var errGenesisHash = errors.New("the genesis block doesn't hash to its fixed hash")
+
+// NewGenesis returns the genesis block of network. The coinbase ID comes
+// from the network name rather than SetID, so it is the same everywhere.
+func NewGenesis(network *Network) *Block {
+	params := genesisBlocks[network]
 
-	pow := NewProofOfWork(b)
-	nonce, hash := pow.Run()
+	address, err := decodeLegacyAddress(genesisAddress)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	id := sha256.Sum256([]byte("nfc genesis " + network.Name))
+	coinbase := &Transaction{id[:], []TxInput{}, []TxOutput{{BlockReward, address.Program}}}
 
-	b.Nonce = nonce
-	b.Hash = hash[:]
+	transactions := []*Transaction{coinbase}
+	header := NewBlockHeader(transactions, []byte{}, GenesisTargetBits, params.Time)
+	header.Nonce = params.Nonce
+
+	b := &Block{header, transactions, header.Hash()}
+	if hex.EncodeToString(b.Hash) != params.Hash || !NewProofOfWork(b).Validate() {
+		fmt.Println("Error is ", errGenesisHash)
+		os.Exit(1)
+	}
 
 	return b
 }
 
-func (bc *BlockChain) MineBlock(transactions []*Transaction) *Block {
+// MineBlock mines transactions right away, after a coinbase paying
+// feeAddr their fees only: no block reward is minted for them.
+func (bc *BlockChain) MineBlock(feeAddr string, transactions []*Transaction) *Block {
+	prevOuts, err := CheckInputsUnspent(transactions, bc.UnspentOutputs())
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	failures := VerifyTransactionsWithPrevOutputs(transactions, prevOuts)
+	if len(failures) > 0 {
+		for _, failure := range failures {
+			fmt.Println(failure)
+		}
+		fmt.Println("found invalid transaction.")
+		os.Exit(1)
+	}
+
+	coinbase := NewCoinbaseTx(feeAddr, "")
+	coinbase.Vout[0].Value = 0
 	for _, tx := range transactions {
-		if tx.Verify(bc) == false {
-			fmt.Println("found invalid transaction.")
+		fee, _ := TxFee(tx, prevOuts)
+		fees, err := coinbase.Vout[0].Value.Add(fee)
+		if err != nil {
+			fmt.Println("Error is ", err)
 			os.Exit(1)
 		}
+		coinbase.Vout[0].Value = fees
+	}
+	// no fees, nothing to pay: an output worth 0 would only clutter the
+	// UTXO set
+	if coinbase.Vout[0].Value == 0 {
+		coinbase.Vout = []TxOutput{}
+	}
+	transactions = append([]*Transaction{coinbase}, transactions...)
+
+	if err := CheckBlockTransactions(transactions); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	if err := CheckCoinbaseValue(transactions, prevOuts); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	block, _, err := bc.AddBlockContext(context.Background(), transactions)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
 	}
-	block := bc.AddBlock(transactions)
 	fmt.Println("Success mint.")
 	return block
 }
 
 func (utxoset *UTXOSet) FindUTXO(address string) []UTXO {
-	pubKeyHashStr := hex.EncodeToString(GetPubKeyHashFromAddr(address))
+	pubKeyHashStr := hex.EncodeToString(AddressPubKeyHash(address))
 
 	return utxoset.UTXOSet[pubKeyHashStr]
 }
 
-func (utxoset *UTXOSet) GetBalance(address string) int {
-	utxos := utxoset.FindUTXO(address)
-	balance := 0
-
-	for _, utxo := range utxos {
-		balance += utxo.Output.Value
+// FindOutpoint looks an unspent output up by its outpointKey.
+func (utxoset *UTXOSet) FindOutpoint(key string) (UTXO, bool) {
+	for _, utxos := range utxoset.UTXOSet {
+		for _, utxo := range utxos {
+			if utxoKey(utxo) == key {
+				return utxo, true
+			}
+		}
 	}
-	return balance
+	return UTXO{}, false
 }
 
-func FindEnoughOutputs(from string, amount int, utxoset *UTXOSet) (int, []UTXO) {
-	useUtxo := []UTXO{}
-	sum := 0
-
-	utxos := utxoset.FindUTXO(from)
+func (utxoset *UTXOSet) GetBalance(address string) (Amount, error) {
+	return SumUTXOs(utxoset.FindUTXO(address))
+}
 
-	for _, out := range utxos {
-		sum += out.Output.Value
-		useUtxo = append(useUtxo, out)
-		if sum >= amount {
-			break
+// SumUTXOs adds up what utxos are worth, an error past MaxMoney.
+func SumUTXOs(utxos []UTXO) (Amount, error) {
+	var sum Amount
+	for _, utxo := range utxos {
+		var err error
+		if sum, err = sum.Add(utxo.Output.Value); err != nil {
+			return 0, err
 		}
 	}
+	return sum, nil
+}
+
+// FindEnoughOutputs selects among the outputs of from that aren't locked
+// or spent in the mempool.
+func FindEnoughOutputs(from string, amount Amount, selector CoinSelector, utxoset *UTXOSet, mempool *Mempool) (Amount, []UTXO) {
+	return selector.Select(AvailableUTXOs(utxoset.FindUTXO(from), mempool), amount)
+}
 
-	return sum, useUtxo
+// SelectOutputs selects with the default coin selector.
+func SelectOutputs(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	return coinSelectors[DefaultCoinSelector].Select(utxos, amount)
 }
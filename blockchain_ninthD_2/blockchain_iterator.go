@@ -26,15 +26,20 @@ func (i *BlockchainIterator) Next() *Block {
 		return nil
 	})
 
-	i.currentHash = block.PreBlockHash
+	if block.Header.HasParent() {
+		i.currentHash = block.Header.PrevBlockHash[:]
+	} else {
+		i.currentHash = []byte{}
+	}
 
 	return block
 }
 
 func PrintBlockInfo(block *Block) {
 
-	fmt.Printf("previous hash : %x\n", block.PreBlockHash)
-	fmt.Printf("block nonce ：%d\n", block.Nonce)
+	fmt.Printf("previous hash : %x\n", block.Header.PrevBlockHash)
+	fmt.Printf("merkle root : %x\n", block.Header.MerkleRoot)
+	fmt.Printf("block nonce ：%d\n", block.Header.Nonce)
 	fmt.Printf("block hash : %x\n", block.Hash)
 
 	fmt.Printf("contains %d transactions\n", len(block.Transactions))
@@ -44,7 +49,7 @@ func PrintBlockInfo(block *Block) {
 		fmt.Printf("	%d transaction contains %d input and %d output\n", ind, len(tx.Vin), len(tx.Vout))
 		fmt.Printf("	is coinbase : %s\n", strconv.FormatBool(tx.IsCoinbase()))
 		for outind, out := range tx.Vout {
-			fmt.Printf("		the value of %d output : %d\n", outind, out.Value)
+			fmt.Printf("		the value of %d output : %s\n", outind, out.Value)
 			fmt.Printf("		the pubkey hash of %d output : %x\n", outind, out.PubKeyHash)
 		}
 
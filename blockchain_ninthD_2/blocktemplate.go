@@ -0,0 +1,217 @@
+package main
+
+import "bytes"
+import "sort"
+import "math/bits"
+import "encoding/hex"
+
+// templateEntry is a mempool transaction with what block assembly weighs.
+type templateEntry struct {
+	tx     *Transaction
+	fee    Amount
+	size   int
+	sigOps int
+	// the mempool transactions whose outputs tx spends
+	parents []*templateEntry
+
+	// the ancestors not picked yet and the package they make with the
+	// entry, see selectPackages
+	ancestors   map[*templateEntry]bool
+	descendants []*templateEntry
+	pkgFee      Amount
+	pkgSize     int
+	pkgSigOps   int
+}
+
+// templateEntries checks the mempool against the chain. A transaction is
+// invalid when a signature fails, an input is neither unspent nor the
+// output of another mempool transaction, it spends an output spent before
+// in the mempool or it pays more than its inputs; transactions spending
+// the outputs of invalid ones are invalid too.
+func (m *Miner) templateEntries() ([]*templateEntry, []*Transaction) {
+	pending := m.mempool.Transactions()
+	sort.Slice(pending, func(i, j int) bool {
+		return bytes.Compare(pending[i].ID, pending[j].ID) < 0
+	})
+
+	byID := make(map[string]*Transaction)
+	for _, tx := range pending {
+		byID[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	prevOuts := m.bc.FindPreviousOutputs(pending)
+
+	bad := make(map[string]bool)
+	for _, failure := range VerifyTransactionsWithPrevOutputs(pending, prevOuts) {
+		bad[failure.TxStr] = true
+	}
+
+	fees := make(map[string]Amount)
+	spent := make(map[string]bool)
+	for _, tx := range pending {
+		txStr := hex.EncodeToString(tx.ID)
+
+		for _, in := range tx.Vin {
+			key := outpointKey(in.Txid, in.Vout)
+			_, inMempool := byID[hex.EncodeToString(in.Txid)]
+
+			if spent[key] || (!inMempool && !m.utxoset.HasInput(in)) {
+				bad[txStr] = true
+			}
+			spent[key] = true
+		}
+
+		fee, err := TxFee(tx, prevOuts)
+		if err != nil || fee < 0 {
+			bad[txStr] = true
+		}
+		fees[txStr] = fee
+	}
+
+	badTxs := []*Transaction{}
+	for txStr := range bad {
+		if tx, ok := byID[txStr]; ok {
+			badTxs = append(badTxs, tx)
+		}
+	}
+	invalid := descendants(badTxs, pending)
+
+	dropped := make(map[string]bool)
+	for _, tx := range invalid {
+		dropped[hex.EncodeToString(tx.ID)] = true
+	}
+
+	entries := []*templateEntry{}
+	entryByID := make(map[string]*templateEntry)
+	for _, tx := range pending {
+		txStr := hex.EncodeToString(tx.ID)
+		if dropped[txStr] {
+			continue
+		}
+
+		entry := &templateEntry{tx: tx, fee: fees[txStr], size: tx.Size(), sigOps: tx.SigOps()}
+		entries = append(entries, entry)
+		entryByID[txStr] = entry
+	}
+
+	for _, entry := range entries {
+		seen := make(map[string]bool)
+		for _, in := range entry.tx.Vin {
+			parentStr := hex.EncodeToString(in.Txid)
+			if parent, ok := entryByID[parentStr]; ok && !seen[parentStr] {
+				seen[parentStr] = true
+				entry.parents = append(entry.parents, parent)
+			}
+		}
+	}
+
+	return entries, invalid
+}
+
+// selectPackages picks entries for a block with room left for maxTxs
+// transactions, maxSize bytes and maxSigOps signature checks. It goes
+// package by package, the highest package feerate first, where the package
+// of an entry is the entry with its ancestors not picked yet: a child
+// paying a high fee pulls in its low fee parents. Parents come before
+// their children in the result. The packages are worked out once and
+// shrunk as their ancestors are picked.
+func selectPackages(entries []*templateEntry, maxTxs, maxSize, maxSigOps int) []*templateEntry {
+	for _, entry := range entries {
+		findAncestors(entry)
+	}
+	for _, entry := range entries {
+		entry.pkgFee, entry.pkgSize, entry.pkgSigOps = entry.fee, entry.size, entry.sigOps
+		for ancestor := range entry.ancestors {
+			entry.pkgFee += ancestor.fee
+			entry.pkgSize += ancestor.size
+			entry.pkgSigOps += ancestor.sigOps
+			ancestor.descendants = append(ancestor.descendants, entry)
+		}
+	}
+
+	picked := []*templateEntry{}
+	included := make(map[*templateEntry]bool)
+	size, sigOps := 0, 0
+
+	for {
+		var best *templateEntry
+
+		for _, entry := range entries {
+			if included[entry] {
+				continue
+			}
+
+			if len(picked)+len(entry.ancestors)+1 > maxTxs || size+entry.pkgSize > maxSize || sigOps+entry.pkgSigOps > maxSigOps {
+				continue
+			}
+
+			if best == nil || feerateAbove(entry.pkgFee, entry.pkgSize, best.pkgFee, best.pkgSize) {
+				best = entry
+			}
+		}
+
+		if best == nil {
+			break
+		}
+
+		// an entry has fewer ancestors left than any of its descendants
+		pkg := []*templateEntry{best}
+		for ancestor := range best.ancestors {
+			pkg = append(pkg, ancestor)
+		}
+		sort.Slice(pkg, func(i, j int) bool {
+			if len(pkg[i].ancestors) != len(pkg[j].ancestors) {
+				return len(pkg[i].ancestors) < len(pkg[j].ancestors)
+			}
+			return bytes.Compare(pkg[i].tx.ID, pkg[j].tx.ID) < 0
+		})
+
+		size += best.pkgSize
+		sigOps += best.pkgSigOps
+		for _, e := range pkg {
+			included[e] = true
+			picked = append(picked, e)
+		}
+
+		for _, e := range pkg {
+			for _, descendant := range e.descendants {
+				if included[descendant] {
+					continue
+				}
+				delete(descendant.ancestors, e)
+				descendant.pkgFee -= e.fee
+				descendant.pkgSize -= e.size
+				descendant.pkgSigOps -= e.sigOps
+			}
+		}
+	}
+
+	return picked
+}
+
+// findAncestors fills in the ancestors of entry and of its ancestors.
+func findAncestors(entry *templateEntry) {
+	if entry.ancestors != nil {
+		return
+	}
+
+	entry.ancestors = make(map[*templateEntry]bool)
+	for _, parent := range entry.parents {
+		findAncestors(parent)
+
+		entry.ancestors[parent] = true
+		for ancestor := range parent.ancestors {
+			entry.ancestors[ancestor] = true
+		}
+	}
+}
+
+// feerateAbove tells whether fee/size is above otherFee/otherSize. The
+// products are 128 bits wide, a fee times a size may not fit in 64; fees
+// are never negative.
+func feerateAbove(fee Amount, size int, otherFee Amount, otherSize int) bool {
+	hi, lo := bits.Mul64(uint64(fee), uint64(otherSize))
+	otherHi, otherLo := bits.Mul64(uint64(otherFee), uint64(size))
+
+	return hi > otherHi || (hi == otherHi && lo > otherLo)
+}
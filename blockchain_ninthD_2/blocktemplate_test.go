@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func blockTemplateTestEntry(id byte, fee Amount, size int, parents ...*templateEntry) *templateEntry {
+	tx := &Transaction{[]byte{id}, []TxInput{}, []TxOutput{}}
+	return &templateEntry{tx: tx, fee: fee, size: size, sigOps: 1, parents: parents}
+}
+
+func blockTemplateTestIDs(entries []*templateEntry) []byte {
+	ids := []byte{}
+	for _, entry := range entries {
+		ids = append(ids, entry.tx.ID[0])
+	}
+	return ids
+}
+
+// a child paying for its parent, 301 for 200 bytes, goes before a
+// transaction paying 140 for 100 bytes, which beats the parent alone
+func TestSelectPackagesChildPaysForParent(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxTxs int
+		want   string
+	}{
+		{"room for all", 10, "\x01\x02\x03"},
+		{"room for one", 1, "\x03"},
+		{"room for two", 2, "\x01\x02"},
+	}
+
+	for _, test := range tests {
+		parent := blockTemplateTestEntry(0x01, 1, 100)
+		child := blockTemplateTestEntry(0x02, 300, 100, parent)
+		other := blockTemplateTestEntry(0x03, 140, 100)
+
+		picked := selectPackages([]*templateEntry{other, child, parent}, test.maxTxs, MaxBlockSize, MaxBlockSigOps)
+		if got := string(blockTemplateTestIDs(picked)); got != test.want {
+			t.Errorf("%s: picked %x, want %x", test.name, got, test.want)
+		}
+	}
+}
+
+// the grandchild is picked with both ancestors, once the parent went in
+// with another child its package is the middle entry and itself
+func TestSelectPackagesSharedAncestor(t *testing.T) {
+	parent := blockTemplateTestEntry(0x01, 0, 100)
+	rich := blockTemplateTestEntry(0x02, 1000, 100, parent)
+	middle := blockTemplateTestEntry(0x03, 0, 100, parent)
+	grandchild := blockTemplateTestEntry(0x04, 150, 100, middle)
+
+	picked := selectPackages([]*templateEntry{grandchild, middle, rich, parent}, 10, MaxBlockSize, MaxBlockSigOps)
+	if got, want := string(blockTemplateTestIDs(picked)), "\x01\x02\x03\x04"; got != want {
+		t.Errorf("picked %x, want %x", got, want)
+	}
+	if grandchild.pkgSize != 200 || grandchild.pkgFee != 150 || len(grandchild.ancestors) != 1 {
+		t.Errorf("grandchild package of %d bytes paying %d with %d ancestors, want 200, 150 and 1",
+			grandchild.pkgSize, grandchild.pkgFee, len(grandchild.ancestors))
+	}
+}
+
+func TestFeerateAboveLargeValues(t *testing.T) {
+	// MaxMoney times a block size doesn't fit in 64 bits
+	if !feerateAbove(MaxMoney-1, MaxBlockSize-1, MaxMoney, MaxBlockSize) {
+		t.Error("a slightly higher feerate compared lower")
+	}
+	if feerateAbove(MaxMoney, MaxBlockSize, MaxMoney-1, MaxBlockSize-1) {
+		t.Error("a slightly lower feerate compared higher")
+	}
+	if feerateAbove(MaxMoney, MaxBlockSize, MaxMoney, MaxBlockSize) {
+		t.Error("equal feerates compared higher")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import "bytes"
+import "errors"
+import "encoding/gob"
+import "encoding/hex"
+import "github.com/boltdb/bolt"
+
+// replaced wallet transactions are kept, with what replaced them, so the
+// history still shows them once they leave the mempool.
+const replacedBucket = "replaced"
+
+// what bumpfee adds to the fee when no fee is given
+const minFeeBump = Coin / 100000
+
+var errNotInMempool = errors.New("the transaction isn't in the mempool")
+var errNotReplaceable = errors.New("the transaction doesn't signal replace-by-fee")
+var errNotWalletTx = errors.New("the wallet can't sign every input of the transaction")
+var errNoChangeOutput = errors.New("the transaction has no change output to take the fee from")
+var errChangeTooSmall = errors.New("the change output can't pay the higher fee")
+var errFeeNotHigher = errors.New("the new fee must be higher than the current one")
+
+type ReplacedTx struct {
+	Tx         *Transaction
+	ReplacedBy string
+}
+
+func (r *ReplacedTx) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(r)
+
+	return result.Bytes()
+}
+
+func DeserializeReplacedTx(buffer []byte) *ReplacedTx {
+	var r ReplacedTx
+
+	decoder := gob.NewDecoder(bytes.NewReader(buffer))
+
+	_ = decoder.Decode(&r)
+
+	return &r
+}
+
+// RecordReplacements keeps the transactions of replaced that touch the
+// wallet, replaced by replacement.
+func (wallets *NFC_Wallets) RecordReplacements(replaced []*Transaction, replacement *Transaction) error {
+	for _, tx := range replaced {
+		if !wallets.involves(tx) {
+			continue
+		}
+
+		r := &ReplacedTx{tx, hex.EncodeToString(replacement.ID)}
+
+		err := wallets.update(func(btx *bolt.Tx) error {
+			b, err := btx.CreateBucketIfNotExists([]byte(replacedBucket))
+			if err != nil {
+				return err
+			}
+
+			return b.Put(tx.ID, r.Serialize())
+		})
+		if err != nil {
+			return err
+		}
+
+		wallets.Replaced[hex.EncodeToString(tx.ID)] = r
+	}
+
+	return nil
+}
+
+func (wallets *NFC_Wallets) involves(tx *Transaction) bool {
+	for _, in := range tx.Vin {
+		if wallets.Ownership(HashPubKey(in.PublicKey)) != NotMine {
+			return true
+		}
+	}
+	for _, out := range tx.Vout {
+		if wallets.Ownership(out.PubKeyHash) != NotMine {
+			return true
+		}
+	}
+	return false
+}
+
+// BumpFee rebuilds txStr, a wallet transaction in the mempool, paying fee
+// instead; the difference comes out of its change output. A fee of 0
+// bumps the current one by minFeeBump. The result is signed and replaces
+// txStr once added to the mempool.
+func BumpFee(txStr string, fee Amount, bc *BlockChain, mempool *Mempool) (*Transaction, error) {
+	pending := mempool.Transactions()
+
+	var original *Transaction
+	for _, tx := range pending {
+		if hex.EncodeToString(tx.ID) == txStr {
+			original = tx
+		}
+	}
+	if original == nil {
+		return nil, errNotInMempool
+	}
+	if !original.SignalsReplacement() {
+		return nil, errNotReplaceable
+	}
+
+	prevOutMap := bc.FindPreviousOutputs(append([]*Transaction{original}, pending...))
+
+	oldFee, err := TxFee(original, prevOutMap)
+	if err != nil {
+		return nil, err
+	}
+	if fee == 0 {
+		fee = oldFee + minFeeBump
+	}
+	if fee <= oldFee {
+		return nil, errFeeNotHigher
+	}
+
+	inputs := []TxInput{}
+	prevOuts := []TxOutput{}
+	funding := make(map[string]bool)
+	for _, in := range original.Vin {
+		prevOut := prevOutMap[outpointKey(in.Txid, in.Vout)]
+		if _, ok := Nfc_wallets.GetWallet(NewPubKeyHashAddress(prevOut.PubKeyHash).String()); !ok {
+			return nil, errNotWalletTx
+		}
+
+		funding[hex.EncodeToString(prevOut.PubKeyHash)] = true
+		prevOuts = append(prevOuts, prevOut)
+		inputs = append(inputs, TxInput{in.Txid, in.Vout, []byte{}, in.PublicKey, in.Sequence})
+	}
+
+	// change is recognised as the ledger does it
+	change := -1
+	for outInd, out := range original.Vout {
+		if Nfc_wallets.Ownership(out.PubKeyHash) == Spendable && (funding[hex.EncodeToString(out.PubKeyHash)] || Nfc_wallets.IsChange(out.PubKeyHash)) {
+			change = outInd
+		}
+	}
+	if change < 0 {
+		return nil, errNoChangeOutput
+	}
+
+	outputs := []TxOutput{}
+	for outInd, out := range original.Vout {
+		if outInd == change {
+			out.Value -= fee - oldFee
+			if out.Value < 0 {
+				return nil, errChangeTooSmall
+			}
+			if out.Value == 0 {
+				continue
+			}
+		}
+		outputs = append(outputs, out)
+	}
+
+	tx := &Transaction{[]byte{}, inputs, outputs}
+	tx.SetID()
+
+	if err := Nfc_wallets.SignTransaction(tx, SigHashAll, prevOuts); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
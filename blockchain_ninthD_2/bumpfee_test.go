@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+import "encoding/hex"
+
+func TestBumpFee(t *testing.T) {
+	w := NewWallet()
+	mine := HashPubKey(w.PublicKey)
+	bc, mp, funding := mempoolTestChain(t, mine, 10*Coin)
+
+	LoadWallets()
+	Nfc_wallets.Wallets[w.GetAddress()] = w
+	defer func() { Nfc_wallets.Wallets = make(map[string]*Wallet) }()
+
+	// 6 coins paid, 3.9 back as change, a fee of 0.1
+	original := &Transaction{[]byte{}, []TxInput{{funding.ID, 0, []byte{}, w.PublicKey, MaxRBFSequence}},
+		[]TxOutput{{6 * Coin, mempoolTestPubKeyHash}, {39 * Coin / 10, mine}}}
+	original.SetID()
+	mustAdd(t, mp, original, bc)
+	txStr := hex.EncodeToString(original.ID)
+
+	tests := []struct {
+		fee Amount
+		err error
+	}{
+		{Coin / 20, errFeeNotHigher},
+		{Coin / 10, errFeeNotHigher},
+		{4*Coin + 1, errChangeTooSmall},
+		{10 * Coin, errChangeTooSmall},
+	}
+	for _, test := range tests {
+		if _, err := BumpFee(txStr, test.fee, bc, mp); err != test.err {
+			t.Errorf("fee %d: got %v, want %v", test.fee, err, test.err)
+		}
+	}
+
+	// the change is used up exactly, its output goes
+	bumped, err := BumpFee(txStr, 4*Coin, bc, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bumped.Vout) != 1 || bumped.Vout[0].Value != 6*Coin {
+		t.Errorf("outputs %v, want the payment only", bumped.Vout)
+	}
+
+	bumped, err = BumpFee(txStr, 0, bc, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bumped.Vout[1].Value != 39*Coin/10-minFeeBump || !bumped.Verify(bc) {
+		t.Fatalf("bumped by default: %v", bumped.Vout)
+	}
+	if replaced := mustAdd(t, mp, bumped, bc); len(replaced) != 1 {
+		t.Fatalf("replaced %d transactions, want the original", len(replaced))
+	}
+
+	if _, err := BumpFee(txStr, 0, bc, mp); err != errNotInMempool {
+		t.Errorf("bumping the replaced transaction: got %v, want %v", err, errNotInMempool)
+	}
+}
+
+func TestBumpFeeNotReplaceable(t *testing.T) {
+	bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10)
+
+	original := spendTestTx(funding, 0, SequenceFinal, 9)
+	mustAdd(t, mp, original, bc)
+
+	if _, err := BumpFee(hex.EncodeToString(original.ID), 0, bc, mp); err != errNotReplaceable {
+		t.Errorf("got %v, want %v", err, errNotReplaceable)
+	}
+}
@@ -3,26 +3,555 @@ package main
 import "fmt"
 import "flag"
 import "os"
+import "encoding/hex"
+import "context"
+import "os/signal"
+import "bufio"
+import "strings"
+import "strconv"
+import "time"
+
+// the commands that sign or add keys, they need an encrypted wallet
+// unlocked
+var keyCommands = map[string]bool{
+	"send":               true,
+	"sendmany":           true,
+	"bumpfee":            true,
+	"signrawtransaction": true,
+	"signpsbt":           true,
+	"createwallet":       true,
+	"getnewaddress":      true,
+	"dumpprivkey":        true,
+	"importprivkey":      true,
+	"hdinit":             true,
+	"hdrestore":          true,
+}
 
 type CLI struct {
 	bc      *BlockChain
 	utxoset *UTXOSet
+	mempool *Mempool
+}
+
+// checkAddress exits when address isn't a valid address outputs can pay to.
+func checkAddress(address string) {
+	AddressPubKeyHash(address)
+}
+
+// getCoinSelector exits on an unknown strategy name.
+func getCoinSelector(name string) CoinSelector {
+	selector, err := GetCoinSelector(name)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	return selector
+}
+
+// addToMempool queues tx and keeps the wallet transactions it replaces in
+// the wallet history.
+func (cli *CLI) addToMempool(tx *Transaction) {
+	replaced, err := cli.mempool.Add(tx, cli.bc)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	if err := Nfc_wallets.RecordReplacements(replaced, tx); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("transaction %x added to the mempool\n", tx.ID)
+	for _, old := range replaced {
+		fmt.Printf("replaces %x\n", old.ID)
+	}
+}
+
+func (cli *CLI) send(from, to string, amount, fee Amount, coinSelect, inputs string, replaceable, mine bool) {
+	checkAddress(from)
+	checkAddress(to)
+	selector := getCoinSelector(coinSelect)
+
+	if amount <= 0 {
+		fmt.Println("Error is ", errBadOutputValue)
+		os.Exit(1)
+	}
+
+	var tx *Transaction
+	if inputs != "" {
+		tx = cli.newTransactionFromInputs(from, to, amount, fee, replaceableSequence(replaceable), strings.Split(inputs, ","))
+	} else {
+		tx = NewUTXOTransaction(from, to, amount, fee, replaceableSequence(replaceable), selector, cli.bc, cli.utxoset, cli.mempool)
+	}
+
+	if !mine {
+		cli.addToMempool(tx)
+		return
+	}
+
+	block := cli.bc.MineBlock(from, []*Transaction{tx})
+	cli.utxoset.Update(block)
+	cli.utxoset.PersistUTXOSet()
+
+	fmt.Printf("Success send %s coins from %s to %s\n", amount, from, to)
+}
+
+// newTransactionFromInputs spends exactly the given outpoints of from.
+func (cli *CLI) newTransactionFromInputs(from, to string, amount, fee Amount, sequence uint32, outpoints []string) *Transaction {
+	utxos, err := SelectInputs(from, outpoints, cli.utxoset, cli.mempool)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	acc, err := SumUTXOs(utxos)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	prevOuts := []TxOutput{}
+	for _, utxo := range utxos {
+		prevOuts = append(prevOuts, utxo.Output)
+	}
+
+	total, err := amount.Add(fee)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	if acc < total {
+		fmt.Println("the given inputs aren't enough to pay for this transaction.")
+		os.Exit(1)
+	}
+
+	tx := NewTransactionFromUTXOs(from, to, amount, fee, sequence, acc, utxos)
+	if err := Nfc_wallets.SignTransaction(tx, SigHashAll, prevOuts); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	return tx
+}
+
+// listUnspent prints the wallet's unspent outputs that pass the filters.
+// An empty address list means every address of the wallet.
+func (cli *CLI) listUnspent(addresses string, minConf, maxConf int, minAmount, maxAmount Amount, lockedOnly bool) {
+	list := []string{}
+	if addresses != "" {
+		for _, address := range strings.Split(addresses, ",") {
+			list = append(list, NewPubKeyHashAddress(AddressPubKeyHash(address)).String())
+		}
+	} else {
+		list = append(Nfc_wallets.Addresses(), Nfc_wallets.WatchedAddresses()...)
+	}
+
+	ledger := BuildLedger(cli.bc, nil)
+	heights := make(map[string]int)
+	for _, entry := range ledger.Entries {
+		heights[entry.TxStr+":"+strconv.Itoa(entry.OutInd)] = entry.Height
+	}
+
+	spent := cli.mempool.MempoolSpent()
+
+	for _, address := range list {
+		for _, utxo := range cli.utxoset.FindUTXO(address) {
+			key := utxoKey(utxo)
+			confirmations := ledger.Confirmations(heights[key])
+			locked := Nfc_wallets.IsLockedUnspent(utxo)
+
+			if confirmations < minConf || (maxConf > 0 && confirmations > maxConf) {
+				continue
+			}
+			if utxo.Output.Value < minAmount || (maxAmount > 0 && utxo.Output.Value > maxAmount) {
+				continue
+			}
+			if lockedOnly && !locked {
+				continue
+			}
+
+			fmt.Printf("%s  %s  %s  confirmations %d", key, address, utxo.Output.Value, confirmations)
+			if locked {
+				fmt.Print("  locked")
+			}
+			if spent[key] {
+				fmt.Print("  spent in mempool")
+			}
+			if Nfc_wallets.Ownership(utxo.Output.PubKeyHash) == WatchOnly {
+				fmt.Print("  watch-only")
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func (cli *CLI) lockUnspent(outpoints string, lock bool) {
+	if outpoints == "" {
+		if lock {
+			fmt.Println("no outpoints given.")
+			os.Exit(1)
+		}
+		if err := Nfc_wallets.UnlockAllUnspent(); err != nil {
+			fmt.Println("Error is ", err)
+			os.Exit(1)
+		}
+		fmt.Println("unlocked every outpoint")
+		return
+	}
+
+	if err := Nfc_wallets.LockUnspent(strings.Split(outpoints, ","), lock, cli.utxoset); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	if lock {
+		fmt.Printf("locked %s\n", outpoints)
+	} else {
+		fmt.Printf("unlocked %s\n", outpoints)
+	}
 }
 
-func (cli *CLI) send(from, to string, amount int) {
-	tx := NewUTXOTransaction(from, to, amount, cli.bc, cli.utxoset)
+func (cli *CLI) sendMany(sources, payeeList string, fee Amount, coinSelect string, replaceable, mine bool) {
+	selector := getCoinSelector(coinSelect)
+
+	payees, err := ParsePayees(payeeList)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fromList := []string{}
+	if sources != "" {
+		fromList = strings.Split(sources, ",")
+	}
+
+	tx, err := NewSendManyTransaction(fromList, payees, fee, replaceableSequence(replaceable), selector, cli.utxoset, cli.mempool)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
 
-	block := cli.bc.MineBlock([]*Transaction{tx})
+	if !mine {
+		cli.addToMempool(tx)
+		return
+	}
+
+	// the fees go back to the first address paying
+	block := cli.bc.MineBlock(NewPubKeyHashAddress(HashPubKey(tx.Vin[0].PublicKey)).String(), []*Transaction{tx})
 	cli.utxoset.Update(block)
 	cli.utxoset.PersistUTXOSet()
 
-	fmt.Printf("Success send %d coins from %s to %s\n", amount, from, to)
+	fmt.Printf("transaction %x paid %d addresses\n", tx.ID, len(payees))
+}
+
+func parseAmountOrExit(s string) Amount {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	return amount
+}
+
+func decodeRawOrExit(raw string) *Transaction {
+	tx, err := DecodeRawTransaction(raw)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	return tx
+}
+
+// replaceableSequence is the input sequence of the transactions built by
+// the CLI, final unless -replaceable is given.
+func replaceableSequence(replaceable bool) uint32 {
+	if replaceable {
+		return MaxRBFSequence
+	}
+	return SequenceFinal
+}
+
+func (cli *CLI) createRawTransaction(inputs, outputs string, replaceable bool) {
+	payees, err := ParsePayees(outputs)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	tx, err := CreateRawTransaction(strings.Split(inputs, ","), payees, replaceableSequence(replaceable))
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(EncodeRawTransaction(tx))
+}
+
+// signRawTransaction signs what the wallet can and prints the transaction
+// again, with how many inputs are left for other wallets.
+func (cli *CLI) signRawTransaction(raw, prevOutList, sigHash string) {
+	tx := decodeRawOrExit(raw)
+
+	hashType, err := ParseSigHashType(sigHash)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	known, err := ParsePrevOuts(prevOutList)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	prevOuts, err := RawPrevOutputs(tx, known, cli.utxoset)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	unsigned, err := Nfc_wallets.SignRawTransaction(tx, hashType, prevOuts)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(EncodeRawTransaction(tx))
+	if unsigned == 0 {
+		fmt.Println("complete")
+	} else {
+		fmt.Printf("incomplete, %d of %d inputs unsigned\n", unsigned, len(tx.Vin))
+	}
+}
+
+func (cli *CLI) decodeRawTransaction(raw string) {
+	out, err := NewRawTx(decodeRawOrExit(raw)).JSON()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(string(out))
+}
+
+func (cli *CLI) sendRawTransaction(raw string) {
+	tx := decodeRawOrExit(raw)
+
+	if err := CheckRawTransaction(tx, cli.bc, cli.utxoset, cli.mempool); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	cli.addToMempool(tx)
+}
+
+func decodePSBTOrExit(encoded string) *PSBT {
+	p, err := DecodePSBT(encoded)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	return p
+}
+
+func (cli *CLI) createPSBT(inputs, outputs, prevOutList, sigHash string, replaceable bool) {
+	payees, err := ParsePayees(outputs)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	hashType, err := ParseSigHashType(sigHash)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	known, err := ParsePrevOuts(prevOutList)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	tx, err := CreateRawTransaction(strings.Split(inputs, ","), payees, replaceableSequence(replaceable))
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	prevOuts, err := RawPrevOutputs(tx, known, cli.utxoset)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	p, err := NewPSBT(tx, prevOuts, hashType)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(p.Encode())
+}
+
+func (cli *CLI) decodePSBT(encoded string) {
+	out, err := decodePSBTOrExit(encoded).JSON()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(string(out))
+}
+
+// signPSBT only reads the wallet, it works on a node without the chain.
+func (cli *CLI) signPSBT(encoded string) {
+	p := decodePSBTOrExit(encoded)
+
+	signed, err := Nfc_wallets.SignPSBT(p)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(p.Encode())
+	fmt.Printf("signed %d of %d inputs\n", signed, len(p.Inputs))
+}
+
+func (cli *CLI) combinePSBT(encodedList string) {
+	var combined *PSBT
+
+	for _, encoded := range strings.Split(encodedList, ",") {
+		p := decodePSBTOrExit(encoded)
+
+		if combined == nil {
+			combined = p
+			continue
+		}
+		if err := combined.Combine(p); err != nil {
+			fmt.Println("Error is ", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Println(combined.Encode())
+}
+
+func (cli *CLI) finalizePSBT(encoded string) {
+	p := decodePSBTOrExit(encoded)
+
+	missing := p.Finalize()
+
+	fmt.Println(p.Encode())
+	if missing == 0 {
+		fmt.Println("complete")
+	} else {
+		fmt.Printf("incomplete, %d of %d inputs unsigned\n", missing, len(p.Inputs))
+	}
+}
+
+// extractPSBT prints the raw transaction sendrawtransaction takes.
+func (cli *CLI) extractPSBT(encoded string) {
+	tx, err := decodePSBTOrExit(encoded).Extract()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(EncodeRawTransaction(tx))
+}
+
+func (cli *CLI) bumpFee(txStr string, fee Amount) {
+	tx, err := BumpFee(txStr, fee, cli.bc, cli.mempool)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	cli.addToMempool(tx)
+}
+
+func (cli *CLI) mine(minerAddr string, blocks int, daemon bool) {
+	if minerAddr == "" {
+		fmt.Println("a miner address is required.")
+		os.Exit(1)
+	}
+	checkAddress(minerAddr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if !daemon && blocks <= 0 {
+		blocks = 1
+	}
+
+	miner := NewMiner(cli.bc, cli.utxoset, cli.mempool, minerAddr)
+	miner.OnBlock = func(block *Block, hashrate float64) {
+		fmt.Printf("mined block %x at %.0f hashes/s\n", block.Hash, hashrate)
+	}
+	mined := miner.Run(ctx, blocks)
+
+	fmt.Printf("mined %d blocks, rewards paid to %s\n", mined, minerAddr)
 }
 
 func (cli *CLI) getBalance(address string) {
-	balance := cli.utxoset.GetBalance(address)
+	if address == "" {
+		cli.getWalletBalance()
+		return
+	}
+
+	checkAddress(address)
+
+	balance := cli.balance(address)
+
+	if _, ok := Nfc_wallets.GetWatchedAddress(address); ok {
+		fmt.Printf("balance of address %s is %s coins. (watch-only)\n", address, balance)
+		return
+	}
+	fmt.Printf("balance of address %s is %s coins.\n", address, balance)
+}
 
-	fmt.Printf("balance of address %s is %d coins.\n", address, balance)
+func (cli *CLI) balance(address string) Amount {
+	balance, err := cli.utxoset.GetBalance(address)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	return balance
+}
+
+// getWalletBalance lists the balance of every address of the wallet, the
+// watch-only ones apart from the spendable ones.
+func (cli *CLI) getWalletBalance() {
+	spendable := []Amount{}
+	for _, address := range Nfc_wallets.Addresses() {
+		balance := cli.balance(address)
+		spendable = append(spendable, balance)
+
+		fmt.Printf("%s  %s\n", address, balance)
+	}
+
+	watchOnly := []Amount{}
+	for _, address := range Nfc_wallets.WatchedAddresses() {
+		balance := cli.balance(address)
+		watchOnly = append(watchOnly, balance)
+
+		fmt.Printf("%s  %s  watch-only %s\n", address, balance, Nfc_wallets.WatchOnly[address].Label)
+	}
+
+	spendableSum, err := SumAmounts(spendable...)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	watchOnlySum, err := SumAmounts(watchOnly...)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("spendable balance is %s coins, watch-only balance is %s coins.\n", spendableSum, watchOnlySum)
 }
 
 func (cli *CLI) printChain() {
@@ -71,43 +600,688 @@ func (cli *CLI) printUTXOSet() {
 	// utxosetDB.LoadUTXOSet()
 }
 
+func (cli *CLI) sync(peerFiles string) {
+	peers := OpenFilePeers(peerFiles)
+	defer ClosePeers(peers)
+
+	err := NewSyncManager(cli.bc, peers).Sync()
+
+	cli.utxoset.UTXOSet = cli.bc.GetUTXOSet()
+	cli.utxoset.PersistUTXOSet()
+
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+}
+
+func (cli *CLI) getFilter(hashStr string) {
+	hash, _ := hex.DecodeString(hashStr)
+
+	data, found := cli.bc.GetBlockFilter(hash)
+	if !found {
+		fmt.Println("no filter for this block.")
+		os.Exit(1)
+	}
+
+	filter, err := DeserializeBlockFilter(data)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("filter of block %s, %d entries\n", hashStr, filter.N())
+	fmt.Println(hex.EncodeToString(data))
+}
+
+func (cli *CLI) hdInit(schemeName string) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	cli.hdRestore(mnemonic, schemeName, 0)
+
+	fmt.Println("write down this mnemonic, it restores every address of the wallet:")
+	fmt.Println(mnemonic)
+}
+
+func (cli *CLI) hdRestore(mnemonic, schemeName string, gapLimit int) {
+	scheme, err := GetSignatureSchemeByName(schemeName)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	keychain, err := NewKeychainFromMnemonic(mnemonic, scheme.Version())
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	found := []*Wallet{}
+	if gapLimit > 0 {
+		found, err = keychain.Discover(cli.bc.UsedPubKeyHashes(), gapLimit)
+		if err != nil {
+			fmt.Println("Error is ", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := Nfc_wallets.InitKeychain(keychain, found); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	for _, wallet := range found {
+		fmt.Printf("found used address %s\n", wallet.GetAddress())
+	}
+
+	address, err := Nfc_wallets.NewAddress(false)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	fmt.Printf("next receiving address %s\n", address)
+}
+
+func (cli *CLI) validateAddress(address string) {
+	if err := ValidateAddress(address); err != nil {
+		fmt.Printf("%s is invalid: %s\n", address, err)
+		os.Exit(1)
+	}
+
+	decoded, _ := DecodeAddress(address)
+	ownership := NotMine
+	if pubKeyHash, err := decoded.PubKeyHash(); err == nil {
+		ownership = Nfc_wallets.Ownership(pubKeyHash)
+	}
+	mine := ownership == Spendable
+
+	fmt.Printf("%s is valid\n", address)
+	fmt.Printf("    network : %s\n", decoded.Network.Name)
+	fmt.Printf("    type : %s\n", addressTypeName(decoded))
+	fmt.Printf("    program : %x\n", decoded.Program)
+	fmt.Printf("    in wallet : %s\n", ownership)
+	if mine && decoded.LegacyVersion != 0 {
+		fmt.Printf("    bech32 address : %s\n", NewPubKeyHashAddress(decoded.Program).String())
+	}
+}
+
+func addressTypeName(address *Address) string {
+	switch address.Type {
+	case PubKeyHashAddress:
+		if address.LegacyVersion != 0 {
+			return "pubkeyhash (base58)"
+		}
+		return "pubkeyhash"
+	case ScriptHashAddress:
+		return "scripthash"
+	case TaprootAddress:
+		return "taproot"
+	}
+	return "unknown"
+}
+
+func (cli *CLI) createWallet(schemeName string) {
+	scheme, err := GetSignatureSchemeByName(schemeName)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	wallet := NewWalletWithScheme(scheme.Version())
+	if err := Nfc_wallets.SaveWallet(wallet); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(wallet.GetAddress())
+}
+
+func (cli *CLI) listAddresses() {
+	for _, address := range Nfc_wallets.Addresses() {
+		wallet := Nfc_wallets.Wallets[address]
+		scheme, _ := KeyScheme(wallet.PublicKey)
+
+		// the base58 form is still valid on mainnet
+		if ActiveNetwork == MainNet {
+			fmt.Printf("%s  %s  %s\n", address, scheme.Name(), wallet.GetLegacyAddress())
+		} else {
+			fmt.Printf("%s  %s\n", address, scheme.Name())
+		}
+	}
+
+	for _, address := range Nfc_wallets.WatchedAddresses() {
+		fmt.Printf("%s  watch-only  %s\n", address, Nfc_wallets.WatchOnly[address].Label)
+	}
+}
+
+func (cli *CLI) listTransactions(address string, skip, count int) {
+	if address != "" {
+		address = NewPubKeyHashAddress(AddressPubKeyHash(address)).String()
+	}
+
+	ledger := BuildLedger(cli.bc, cli.mempool)
+
+	for _, entry := range ledger.Page(address, skip, count) {
+		fmt.Printf("%s:%d  %-8s  %s  %s", entry.TxStr, entry.OutInd, entry.Category, entry.Amount.SignedString(), entry.Address)
+		if entry.Ownership == WatchOnly {
+			fmt.Print("  watch-only")
+		}
+		fmt.Printf("  confirmations %d", ledger.Confirmations(entry.Height))
+		if entry.Height >= 0 {
+			fmt.Printf("  height %d", entry.Height)
+		}
+		if entry.ReplacedBy != "" {
+			fmt.Printf("  replaced by %s", entry.ReplacedBy)
+		}
+		fmt.Println()
+	}
+}
+
+func (cli *CLI) getTransaction(txStr string) {
+	ledger := BuildLedger(cli.bc, cli.mempool)
+
+	ltx, ok := ledger.GetTransaction(txStr)
+	if !ok {
+		fmt.Println("the transaction doesn't touch the wallet.")
+		os.Exit(1)
+	}
+
+	fmt.Printf("transaction str : %s\n", ltx.TxStr)
+	fmt.Printf("net amount : %s\n", ltx.Net.SignedString())
+	if ltx.FeeKnown {
+		fmt.Printf("fee : %s\n", ltx.Fee)
+	} else {
+		fmt.Println("fee : unknown")
+	}
+	fmt.Printf("confirmations : %d\n", ledger.Confirmations(ltx.Height))
+	if ltx.ReplacedBy != "" {
+		fmt.Printf("replaced by : %s\n", ltx.ReplacedBy)
+	}
+	for _, txStr := range ltx.Replaces {
+		fmt.Printf("replaces : %s\n", txStr)
+	}
+	if ltx.Height >= 0 {
+		fmt.Printf("block hash : %x\n", ltx.BlockHash)
+		fmt.Printf("block height : %d\n", ltx.Height)
+		fmt.Printf("block time : %s\n", time.Unix(int64(ltx.Time), 0).UTC().Format(time.RFC3339))
+	}
+
+	for _, entry := range ltx.Entries {
+		fmt.Printf("    output %d  %-8s  %s  %s", entry.OutInd, entry.Category, entry.Amount.SignedString(), entry.Address)
+		if entry.Ownership == WatchOnly {
+			fmt.Print("  watch-only")
+		}
+		fmt.Println()
+	}
+}
+
+func (cli *CLI) importAddress(address, label string) {
+	watched, err := Nfc_wallets.ImportAddress(address, label)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("watching %s, balance %s coins\n", watched.Address(), cli.balance(watched.Address()))
+}
+
+func (cli *CLI) getNewAddress(change bool) {
+	address, err := Nfc_wallets.NewAddress(change)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(address)
+}
+
+func (cli *CLI) dumpPrivKey(address string) {
+	wallet, ok := Nfc_wallets.GetWallet(address)
+	if !ok {
+		fmt.Println("Error is ", errNotOwned)
+		os.Exit(1)
+	}
+
+	encoded, err := wallet.ExportPrivateKey()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(encoded)
+}
+
+func (cli *CLI) importPrivKey(encoded string) {
+	wallet, err := ImportPrivateKey(encoded)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	if err := Nfc_wallets.SaveWallet(wallet); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("imported %s, balance %s coins\n", wallet.GetAddress(), cli.balance(wallet.GetAddress()))
+}
+
+// removeAddress refuses to drop a key that still holds coins unless forced.
+func (cli *CLI) removeAddress(address string, force bool) {
+	if _, ok := Nfc_wallets.GetWallet(address); ok && !force {
+		if balance := cli.balance(address); balance > 0 {
+			fmt.Printf("%s still holds %s coins, use -force to remove it anyway.\n", address, balance)
+			os.Exit(1)
+		}
+	}
+
+	if _, ok := Nfc_wallets.GetWatchedAddress(address); ok {
+		if err := Nfc_wallets.RemoveWatchedAddress(address); err != nil {
+			fmt.Println("Error is ", err)
+			os.Exit(1)
+		}
+		fmt.Printf("stopped watching %s\n", address)
+		return
+	}
+
+	if err := Nfc_wallets.RemoveWallet(address); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("removed %s\n", address)
+}
+
+// shared by the prompts and the unlock session, a reader of its own
+// would buffer the lines meant for the others
+var stdin = bufio.NewReader(os.Stdin)
+
+// passphraseOrPrompt returns passphrase, or reads it from stdin when it
+// wasn't given, which keeps it out of the process list.
+func passphraseOrPrompt(passphrase, prompt string) string {
+	if passphrase != "" {
+		return passphrase
+	}
+
+	fmt.Print(prompt)
+	line, _ := stdin.ReadString('\n')
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+func (cli *CLI) encryptWallet(passphrase string) {
+	passphrase = passphraseOrPrompt(passphrase, "new passphrase: ")
+	if passphrase == "" {
+		fmt.Println("the passphrase can't be empty.")
+		os.Exit(1)
+	}
+
+	if err := Nfc_wallets.EncryptWallet(passphrase); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("wallet encrypted, commands using its keys will ask for the passphrase.")
+}
+
+// unlock asks for the passphrase of the encrypted wallet, the keys stay
+// decrypted for this command only.
+func (cli *CLI) unlock() {
+	passphrase := passphraseOrPrompt("", "passphrase: ")
+
+	if err := Nfc_wallets.Unlock(passphrase, 0); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+}
+
+// unlockSession keeps the wallet unlocked for timeout seconds and runs
+// the commands read from stdin meanwhile. The keys are only ever in this
+// process's memory, the session ends on lock, an empty line, the first
+// command after the timeout or a command that fails.
+func (cli *CLI) unlockSession(passphrase string, timeout int) {
+	if timeout <= 0 {
+		fmt.Println("the timeout must be positive.")
+		os.Exit(1)
+	}
+
+	passphrase = passphraseOrPrompt(passphrase, "passphrase: ")
+
+	if err := Nfc_wallets.Unlock(passphrase, time.Duration(timeout)*time.Second); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("wallet unlocked for %d seconds, enter commands, lock or an empty line to end\n", timeout)
+
+	for {
+		fmt.Print("> ")
+		line, _ := stdin.ReadString('\n')
+		args := strings.Fields(line)
+		if len(args) == 0 || args[0] == "lock" {
+			break
+		}
+
+		if Nfc_wallets.IsLocked() {
+			fmt.Println("the unlock timed out.")
+			break
+		}
+
+		if args[0] == "unlock" {
+			fmt.Println("the wallet is already unlocked.")
+			continue
+		}
+
+		cli.Run(args)
+	}
+
+	cli.lock()
+}
+
+func (cli *CLI) lock() {
+	Nfc_wallets.Lock()
+
+	fmt.Println("wallet locked")
+}
+
+func (cli *CLI) changePassphrase(oldPassphrase, newPassphrase string) {
+	oldPassphrase = passphraseOrPrompt(oldPassphrase, "old passphrase: ")
+	newPassphrase = passphraseOrPrompt(newPassphrase, "new passphrase: ")
+	if newPassphrase == "" {
+		fmt.Println("the passphrase can't be empty.")
+		os.Exit(1)
+	}
+
+	if err := Nfc_wallets.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("passphrase changed, the wallet is locked.")
+}
+
 func (cli *CLI) printUsage() {
-	fmt.Println("Usage: [addblock -data='***'] [printchain]")
+	fmt.Println("Usage: [-network mainnet|testnet|regtest] [-spv CHAINFILE[,CHAINFILE...]] COMMAND")
+	fmt.Println("  printchain")
+	fmt.Println("  printutxoset")
+	fmt.Println("  getbalance [-address ADDRESS]")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-coinselect bnb|largest|smallest|random] [-inputs TXID:VOUT,...] [-fee FEE] [-replaceable] [-mine=false]")
+	fmt.Println("  sendmany -to ADDRESS=AMOUNT[,ADDRESS=AMOUNT...] [-from ADDRESS[,ADDRESS...]] [-coinselect STRATEGY] [-fee FEE] [-replaceable] [-mine=false]")
+	fmt.Println("  createrawtransaction -inputs TXID:VOUT[,TXID:VOUT...] -outputs ADDRESS=AMOUNT[,ADDRESS=AMOUNT...] [-replaceable]")
+	fmt.Println("  signrawtransaction -hex HEX [-prevouts TXID:VOUT:ADDRESS:AMOUNT,...] [-sighash ALL|NONE|SINGLE[|ANYONECANPAY]]")
+	fmt.Println("  decoderawtransaction -hex HEX")
+	fmt.Println("  sendrawtransaction -hex HEX")
+	fmt.Println("  bumpfee -txid TXID [-fee FEE]")
+	fmt.Println("  createpsbt -inputs TXID:VOUT[,TXID:VOUT...] -outputs ADDRESS=AMOUNT[,ADDRESS=AMOUNT...] [-prevouts TXID:VOUT:ADDRESS:AMOUNT,...] [-sighash TYPE] [-replaceable]")
+	fmt.Println("  decodepsbt -psbt PSBT")
+	fmt.Println("  signpsbt -psbt PSBT")
+	fmt.Println("  combinepsbt -psbts PSBT,PSBT[,PSBT...]")
+	fmt.Println("  finalizepsbt -psbt PSBT")
+	fmt.Println("  extractpsbt -psbt PSBT")
+	fmt.Println("  listunspent [-addresses ADDRESS,...] [-minconf N] [-maxconf N] [-minamount AMOUNT] [-maxamount AMOUNT] [-locked]")
+	fmt.Println("  lockunspent -outpoints TXID:VOUT,...")
+	fmt.Println("  unlockunspent [-outpoints TXID:VOUT,...]")
+	fmt.Println("  mine -miner-address ADDRESS [-blocks N] [-daemon]")
+	fmt.Println("  sync -peers CHAINFILE[,CHAINFILE...]")
+	fmt.Println("  getfilter -hash BLOCKHASH")
+	fmt.Println("  hdinit [-scheme p256|ed25519|schnorr]")
+	fmt.Println("  hdrestore -mnemonic WORDS [-scheme p256|ed25519|schnorr] [-gap N]")
+	fmt.Println("  validateaddress -address ADDRESS")
+	fmt.Println("  createwallet [-scheme p256|ed25519|schnorr]")
+	fmt.Println("  listaddresses")
+	fmt.Println("  listtransactions [-address ADDRESS] [-count N] [-skip N]")
+	fmt.Println("  gettransaction -txid TXID")
+	fmt.Println("  getnewaddress [-change]")
+	fmt.Println("  importaddress -address ADDRESS [-label LABEL]")
+	fmt.Println("  dumpprivkey -address ADDRESS")
+	fmt.Println("  importprivkey -key PRIVKEY")
+	fmt.Println("  removeaddress -address ADDRESS [-force]")
+	fmt.Println("  encryptwallet [-passphrase PASSPHRASE]")
+	fmt.Println("  unlock [-passphrase PASSPHRASE] [-timeout SECONDS]")
+	fmt.Println("  lock")
+	fmt.Println("  changepassphrase [-old PASSPHRASE] [-new PASSPHRASE]")
 }
 
-func (cli *CLI) Run() {
+func (cli *CLI) Run(args []string) {
+	if len(args) == 0 {
+		cli.printUsage()
+		os.Exit(1)
+	}
+
 	// cli.validateArgs()
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	sendTxCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	printutxoset := flag.NewFlagSet("printutxoset", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)
+	createRawCmd := flag.NewFlagSet("createrawtransaction", flag.ExitOnError)
+	signRawCmd := flag.NewFlagSet("signrawtransaction", flag.ExitOnError)
+	decodeRawCmd := flag.NewFlagSet("decoderawtransaction", flag.ExitOnError)
+	sendRawCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	decodePSBTCmd := flag.NewFlagSet("decodepsbt", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	combinePSBTCmd := flag.NewFlagSet("combinepsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
+	extractPSBTCmd := flag.NewFlagSet("extractpsbt", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("listunspent", flag.ExitOnError)
+	lockUnspentCmd := flag.NewFlagSet("lockunspent", flag.ExitOnError)
+	unlockUnspentCmd := flag.NewFlagSet("unlockunspent", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	syncCmd := flag.NewFlagSet("sync", flag.ExitOnError)
+	getFilterCmd := flag.NewFlagSet("getfilter", flag.ExitOnError)
+	hdInitCmd := flag.NewFlagSet("hdinit", flag.ExitOnError)
+	hdRestoreCmd := flag.NewFlagSet("hdrestore", flag.ExitOnError)
+	validateAddressCmd := flag.NewFlagSet("validateaddress", flag.ExitOnError)
+	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	getNewAddressCmd := flag.NewFlagSet("getnewaddress", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	removeAddressCmd := flag.NewFlagSet("removeaddress", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	unlockCmd := flag.NewFlagSet("unlock", flag.ExitOnError)
+	lockCmd := flag.NewFlagSet("lock", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
 
 	sendFrom := sendTxCmd.String("from", "", "the sender of this transaction")
 	sendTo := sendTxCmd.String("to", "", "the recipetor of this transaction")
-	sendAmount := sendTxCmd.Int("amount", 0, "amount of coin")
+	sendAmount := sendTxCmd.String("amount", "0", "amount of coin, like 1.5")
+	sendCoinSelect := sendTxCmd.String("coinselect", DefaultCoinSelector, "coin selection: bnb, largest, smallest or random")
+	sendFee := sendTxCmd.String("fee", "0", "fee paid to the miner")
+	sendInputs := sendTxCmd.String("inputs", "", "comma separated TXID:VOUT outputs of FROM to spend, instead of coin selection")
+	sendReplaceable := sendTxCmd.Bool("replaceable", false, "signal replace-by-fee, so bumpfee can replace it")
+	sendMine := sendTxCmd.Bool("mine", true, "mine a block right away instead of leaving the transaction in the mempool")
+
+	sendManyTo := sendManyCmd.String("to", "", "comma separated ADDRESS=AMOUNT payees")
+	sendManyFrom := sendManyCmd.String("from", "", "comma separated source addresses, every spendable address by default")
+	sendManyCoinSelect := sendManyCmd.String("coinselect", DefaultCoinSelector, "coin selection: bnb, largest, smallest or random")
+	sendManyFee := sendManyCmd.String("fee", "0", "fee paid to the miner")
+	sendManyReplaceable := sendManyCmd.Bool("replaceable", false, "signal replace-by-fee, so bumpfee can replace it")
+	sendManyMine := sendManyCmd.Bool("mine", true, "mine a block right away instead of leaving the transaction in the mempool")
+
+	createRawInputs := createRawCmd.String("inputs", "", "comma separated TXID:VOUT outputs to spend")
+	createRawOutputs := createRawCmd.String("outputs", "", "comma separated ADDRESS=AMOUNT outputs")
+	createRawReplaceable := createRawCmd.Bool("replaceable", false, "signal replace-by-fee")
+
+	bumpFeeTxid := bumpFeeCmd.String("txid", "", "the wallet transaction to replace")
+	bumpFeeFee := bumpFeeCmd.String("fee", "0", "the new fee, the current one plus "+minFeeBump.String()+" by default")
+
+	signRawHex := signRawCmd.String("hex", "", "the raw transaction")
+	signRawPrevOuts := signRawCmd.String("prevouts", "", "comma separated TXID:VOUT:ADDRESS:AMOUNT outputs spent, for outputs the node doesn't know")
+	signRawSigHash := signRawCmd.String("sighash", "ALL", "sighash type")
+
+	decodeRawHex := decodeRawCmd.String("hex", "", "the raw transaction")
+	sendRawHex := sendRawCmd.String("hex", "", "the raw transaction")
+
+	createPSBTInputs := createPSBTCmd.String("inputs", "", "comma separated TXID:VOUT outputs to spend")
+	createPSBTOutputs := createPSBTCmd.String("outputs", "", "comma separated ADDRESS=AMOUNT outputs")
+	createPSBTPrevOuts := createPSBTCmd.String("prevouts", "", "comma separated TXID:VOUT:ADDRESS:AMOUNT outputs spent, for outputs the node doesn't know")
+	createPSBTSigHash := createPSBTCmd.String("sighash", "ALL", "sighash type the inputs are to be signed with")
+	createPSBTReplaceable := createPSBTCmd.Bool("replaceable", false, "signal replace-by-fee")
+
+	decodePSBTData := decodePSBTCmd.String("psbt", "", "the partially signed transaction")
+	signPSBTData := signPSBTCmd.String("psbt", "", "the partially signed transaction")
+	combinePSBTData := combinePSBTCmd.String("psbts", "", "comma separated copies of one partially signed transaction")
+	finalizePSBTData := finalizePSBTCmd.String("psbt", "", "the partially signed transaction")
+	extractPSBTData := extractPSBTCmd.String("psbt", "", "the finalized partially signed transaction")
+
+	listUnspentAddrs := listUnspentCmd.String("addresses", "", "comma separated addresses, every address of the wallet by default")
+	listUnspentMinConf := listUnspentCmd.Int("minconf", 0, "least confirmations")
+	listUnspentMaxConf := listUnspentCmd.Int("maxconf", 0, "most confirmations, 0 means no limit")
+	listUnspentMinAmount := listUnspentCmd.String("minamount", "0", "smallest amount")
+	listUnspentMaxAmount := listUnspentCmd.String("maxamount", "0", "largest amount, 0 means no limit")
+	listUnspentLocked := listUnspentCmd.Bool("locked", false, "only list locked outputs")
+
+	lockOutpoints := lockUnspentCmd.String("outpoints", "", "comma separated TXID:VOUT outputs to lock")
+	unlockOutpoints := unlockUnspentCmd.String("outpoints", "", "comma separated TXID:VOUT outputs to unlock, all of them by default")
+
+	mineAddr := mineCmd.String("miner-address", "", "the address the coinbase pays to")
+	mineBlocks := mineCmd.Int("blocks", 0, "stop after this many blocks, 0 means no limit in daemon mode")
+	mineDaemon := mineCmd.Bool("daemon", false, "keep mining blocks from the mempool")
+
+	syncPeers := syncCmd.String("peers", "", "comma separated chain files of the nodes to sync from")
+
+	getFilterHash := getFilterCmd.String("hash", "", "the block hash in hex")
+
+	hdInitScheme := hdInitCmd.String("scheme", "p256", "signature scheme of the derived keys")
+
+	hdRestoreMnemonic := hdRestoreCmd.String("mnemonic", "", "the BIP39 mnemonic to restore from")
+	hdRestoreScheme := hdRestoreCmd.String("scheme", "p256", "signature scheme of the derived keys")
+	hdRestoreGap := hdRestoreCmd.Int("gap", HDGapLimit, "unused addresses in a row before discovery stops")
+
+	validateAddressAddr := validateAddressCmd.String("address", "", "the address to check")
+
+	createWalletScheme := createWalletCmd.String("scheme", "p256", "signature scheme of the new key")
+
+	getNewAddressChange := getNewAddressCmd.Bool("change", false, "derive from the change chain")
+
+	listTxAddr := listTransactionsCmd.String("address", "", "only list the entries of this address")
+	listTxCount := listTransactionsCmd.Int("count", 10, "entries per page")
+	listTxSkip := listTransactionsCmd.Int("skip", 0, "newest entries to skip")
+
+	getTxID := getTransactionCmd.String("txid", "", "the transaction str")
+
+	importAddressAddr := importAddressCmd.String("address", "", "the address to watch")
+	importAddressLabel := importAddressCmd.String("label", "", "a label shown next to the address")
+
+	dumpPrivKeyAddr := dumpPrivKeyCmd.String("address", "", "the address whose key is printed")
+
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "a private key printed by dumpprivkey")
+
+	removeAddressAddr := removeAddressCmd.String("address", "", "the address to remove")
+	removeAddressForce := removeAddressCmd.Bool("force", false, "remove it even if it holds coins")
+
+	encryptPassphrase := encryptWalletCmd.String("passphrase", "", "the passphrase, read from stdin when empty")
+
+	unlockPassphrase := unlockCmd.String("passphrase", "", "the passphrase, read from stdin when empty")
+	unlockTimeout := unlockCmd.Int("timeout", 300, "seconds before the wallet locks again")
+
+	changeOld := changePassphraseCmd.String("old", "", "the current passphrase, read from stdin when empty")
+	changeNew := changePassphraseCmd.String("new", "", "the new passphrase, read from stdin when empty")
 
 	getBlcAddr := getBalanceCmd.String("address", "", "which address do you want to query?")
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "printchain":
-		_ = printChainCmd.Parse(os.Args[2:])
+		_ = printChainCmd.Parse(args[1:])
 	case "send":
-		_ = sendTxCmd.Parse(os.Args[2:])
+		_ = sendTxCmd.Parse(args[1:])
 	case "getbalance":
-		_ = getBalanceCmd.Parse(os.Args[2:])
+		_ = getBalanceCmd.Parse(args[1:])
 	case "printutxoset":
-		_ = printutxoset.Parse(os.Args[2:])
+		_ = printutxoset.Parse(args[1:])
+	case "sendmany":
+		_ = sendManyCmd.Parse(args[1:])
+	case "bumpfee":
+		_ = bumpFeeCmd.Parse(args[1:])
+	case "createrawtransaction":
+		_ = createRawCmd.Parse(args[1:])
+	case "signrawtransaction":
+		_ = signRawCmd.Parse(args[1:])
+	case "decoderawtransaction":
+		_ = decodeRawCmd.Parse(args[1:])
+	case "sendrawtransaction":
+		_ = sendRawCmd.Parse(args[1:])
+	case "createpsbt":
+		_ = createPSBTCmd.Parse(args[1:])
+	case "decodepsbt":
+		_ = decodePSBTCmd.Parse(args[1:])
+	case "signpsbt":
+		_ = signPSBTCmd.Parse(args[1:])
+	case "combinepsbt":
+		_ = combinePSBTCmd.Parse(args[1:])
+	case "finalizepsbt":
+		_ = finalizePSBTCmd.Parse(args[1:])
+	case "extractpsbt":
+		_ = extractPSBTCmd.Parse(args[1:])
+	case "listunspent":
+		_ = listUnspentCmd.Parse(args[1:])
+	case "lockunspent":
+		_ = lockUnspentCmd.Parse(args[1:])
+	case "unlockunspent":
+		_ = unlockUnspentCmd.Parse(args[1:])
+	case "mine":
+		_ = mineCmd.Parse(args[1:])
+	case "sync":
+		_ = syncCmd.Parse(args[1:])
+	case "getfilter":
+		_ = getFilterCmd.Parse(args[1:])
+	case "hdinit":
+		_ = hdInitCmd.Parse(args[1:])
+	case "hdrestore":
+		_ = hdRestoreCmd.Parse(args[1:])
+	case "validateaddress":
+		_ = validateAddressCmd.Parse(args[1:])
+	case "createwallet":
+		_ = createWalletCmd.Parse(args[1:])
+	case "listaddresses":
+		_ = listAddressesCmd.Parse(args[1:])
+	case "getnewaddress":
+		_ = getNewAddressCmd.Parse(args[1:])
+	case "listtransactions":
+		_ = listTransactionsCmd.Parse(args[1:])
+	case "gettransaction":
+		_ = getTransactionCmd.Parse(args[1:])
+	case "importaddress":
+		_ = importAddressCmd.Parse(args[1:])
+	case "dumpprivkey":
+		_ = dumpPrivKeyCmd.Parse(args[1:])
+	case "importprivkey":
+		_ = importPrivKeyCmd.Parse(args[1:])
+	case "removeaddress":
+		_ = removeAddressCmd.Parse(args[1:])
+	case "encryptwallet":
+		_ = encryptWalletCmd.Parse(args[1:])
+	case "unlock":
+		_ = unlockCmd.Parse(args[1:])
+	case "lock":
+		_ = lockCmd.Parse(args[1:])
+	case "changepassphrase":
+		_ = changePassphraseCmd.Parse(args[1:])
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
+	if keyCommands[args[0]] && Nfc_wallets.IsLocked() {
+		cli.unlock()
+	}
+
 	if printChainCmd.Parsed() {
 		cli.printChain()
 	}
 
 	if sendTxCmd.Parsed() {
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, *sendTo, parseAmountOrExit(*sendAmount), parseAmountOrExit(*sendFee), *sendCoinSelect, *sendInputs, *sendReplaceable, *sendMine)
 	}
 
 	if getBalanceCmd.Parsed() {
@@ -117,4 +1291,140 @@ func (cli *CLI) Run() {
 	if printutxoset.Parsed() {
 		cli.printUTXOSet()
 	}
+
+	if sendManyCmd.Parsed() {
+		cli.sendMany(*sendManyFrom, *sendManyTo, parseAmountOrExit(*sendManyFee), *sendManyCoinSelect, *sendManyReplaceable, *sendManyMine)
+	}
+
+	if createRawCmd.Parsed() {
+		cli.createRawTransaction(*createRawInputs, *createRawOutputs, *createRawReplaceable)
+	}
+
+	if bumpFeeCmd.Parsed() {
+		cli.bumpFee(*bumpFeeTxid, parseAmountOrExit(*bumpFeeFee))
+	}
+
+	if signRawCmd.Parsed() {
+		cli.signRawTransaction(*signRawHex, *signRawPrevOuts, *signRawSigHash)
+	}
+
+	if decodeRawCmd.Parsed() {
+		cli.decodeRawTransaction(*decodeRawHex)
+	}
+
+	if sendRawCmd.Parsed() {
+		cli.sendRawTransaction(*sendRawHex)
+	}
+
+	if createPSBTCmd.Parsed() {
+		cli.createPSBT(*createPSBTInputs, *createPSBTOutputs, *createPSBTPrevOuts, *createPSBTSigHash, *createPSBTReplaceable)
+	}
+
+	if decodePSBTCmd.Parsed() {
+		cli.decodePSBT(*decodePSBTData)
+	}
+
+	if signPSBTCmd.Parsed() {
+		cli.signPSBT(*signPSBTData)
+	}
+
+	if combinePSBTCmd.Parsed() {
+		cli.combinePSBT(*combinePSBTData)
+	}
+
+	if finalizePSBTCmd.Parsed() {
+		cli.finalizePSBT(*finalizePSBTData)
+	}
+
+	if extractPSBTCmd.Parsed() {
+		cli.extractPSBT(*extractPSBTData)
+	}
+
+	if listUnspentCmd.Parsed() {
+		cli.listUnspent(*listUnspentAddrs, *listUnspentMinConf, *listUnspentMaxConf, parseAmountOrExit(*listUnspentMinAmount), parseAmountOrExit(*listUnspentMaxAmount), *listUnspentLocked)
+	}
+
+	if lockUnspentCmd.Parsed() {
+		cli.lockUnspent(*lockOutpoints, true)
+	}
+
+	if unlockUnspentCmd.Parsed() {
+		cli.lockUnspent(*unlockOutpoints, false)
+	}
+
+	if mineCmd.Parsed() {
+		cli.mine(*mineAddr, *mineBlocks, *mineDaemon)
+	}
+
+	if syncCmd.Parsed() {
+		cli.sync(*syncPeers)
+	}
+
+	if getFilterCmd.Parsed() {
+		cli.getFilter(*getFilterHash)
+	}
+
+	if hdInitCmd.Parsed() {
+		cli.hdInit(*hdInitScheme)
+	}
+
+	if hdRestoreCmd.Parsed() {
+		cli.hdRestore(*hdRestoreMnemonic, *hdRestoreScheme, *hdRestoreGap)
+	}
+
+	if validateAddressCmd.Parsed() {
+		cli.validateAddress(*validateAddressAddr)
+	}
+
+	if createWalletCmd.Parsed() {
+		cli.createWallet(*createWalletScheme)
+	}
+
+	if listAddressesCmd.Parsed() {
+		cli.listAddresses()
+	}
+
+	if getNewAddressCmd.Parsed() {
+		cli.getNewAddress(*getNewAddressChange)
+	}
+
+	if listTransactionsCmd.Parsed() {
+		cli.listTransactions(*listTxAddr, *listTxSkip, *listTxCount)
+	}
+
+	if getTransactionCmd.Parsed() {
+		cli.getTransaction(*getTxID)
+	}
+
+	if importAddressCmd.Parsed() {
+		cli.importAddress(*importAddressAddr, *importAddressLabel)
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		cli.dumpPrivKey(*dumpPrivKeyAddr)
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		cli.importPrivKey(*importPrivKeyKey)
+	}
+
+	if removeAddressCmd.Parsed() {
+		cli.removeAddress(*removeAddressAddr, *removeAddressForce)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(*encryptPassphrase)
+	}
+
+	if unlockCmd.Parsed() {
+		cli.unlockSession(*unlockPassphrase, *unlockTimeout)
+	}
+
+	if lockCmd.Parsed() {
+		cli.lock()
+	}
+
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase(*changeOld, *changeNew)
+	}
 }
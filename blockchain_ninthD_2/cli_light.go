@@ -0,0 +1,82 @@
+package main
+
+import "fmt"
+import "flag"
+import "os"
+
+// LightCLI offers the wallet commands of CLI on top of a LightClient.
+type LightCLI struct {
+	lc *LightClient
+}
+
+func (cli *LightCLI) send(from, to string, amount Amount) {
+	checkAddress(from)
+	checkAddress(to)
+
+	if amount <= 0 {
+		fmt.Println("Error is ", errBadOutputValue)
+		os.Exit(1)
+	}
+
+	tx := cli.lc.Send(from, to, amount)
+
+	fmt.Printf("transaction %x sent, %s coins from %s to %s\n", tx.ID, amount, from, to)
+}
+
+func (cli *LightCLI) getBalance(address string) {
+	checkAddress(address)
+
+	balance, err := cli.lc.GetBalance(address)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	if _, ok := Nfc_wallets.GetWatchedAddress(address); ok {
+		fmt.Printf("balance of address %s is %s coins. (watch-only)\n", address, balance)
+		return
+	}
+	fmt.Printf("balance of address %s is %s coins.\n", address, balance)
+}
+
+func (cli *LightCLI) printUsage() {
+	fmt.Println("Usage: [-network mainnet|testnet|regtest] -spv CHAINFILE[,CHAINFILE...] [-filters] COMMAND")
+	fmt.Println("  getbalance -address ADDRESS")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT")
+}
+
+func (cli *LightCLI) Run(args []string) {
+	if len(args) == 0 {
+		cli.printUsage()
+		os.Exit(1)
+	}
+
+	sendTxCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+
+	sendFrom := sendTxCmd.String("from", "", "the sender of this transaction")
+	sendTo := sendTxCmd.String("to", "", "the recipetor of this transaction")
+	sendAmount := sendTxCmd.String("amount", "0", "amount of coin, like 1.5")
+
+	getBlcAddr := getBalanceCmd.String("address", "", "which address do you want to query?")
+
+	switch args[0] {
+	case "send":
+		_ = sendTxCmd.Parse(args[1:])
+	case "getbalance":
+		_ = getBalanceCmd.Parse(args[1:])
+	default:
+		cli.printUsage()
+		os.Exit(1)
+	}
+
+	cli.lc.SyncHeaders()
+
+	if sendTxCmd.Parsed() {
+		cli.send(*sendFrom, *sendTo, parseAmountOrExit(*sendAmount))
+	}
+
+	if getBalanceCmd.Parsed() {
+		cli.getBalance(*getBlcAddr)
+	}
+}
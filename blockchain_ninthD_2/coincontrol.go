@@ -0,0 +1,190 @@
+package main
+
+import "errors"
+import "strconv"
+import "strings"
+import "encoding/hex"
+import "github.com/boltdb/bolt"
+
+// locked outpoints are kept out of automatic coin selection until they
+// are unlocked, they can still be spent with send -inputs.
+const lockedUnspentBucket = "lockedunspent"
+
+var errBadOutpoint = errors.New("outpoints are TXID:VOUT")
+var errUnknownOutpoint = errors.New("the outpoint isn't an unspent output of the address")
+var errOutpointInMempool = errors.New("the outpoint is already spent by a mempool transaction")
+var errNotWalletOutpoint = errors.New("the outpoint isn't an unspent output of the wallet")
+var errNotLocked = errors.New("the outpoint isn't locked")
+
+// ParseOutpoint parses "txid:vout" into the key outpointKey makes.
+func ParseOutpoint(outpoint string) (string, error) {
+	txid, vout, err := splitOutpoint(outpoint)
+	if err != nil {
+		return "", err
+	}
+
+	return outpointKey(txid, vout), nil
+}
+
+func splitOutpoint(outpoint string) ([]byte, int, error) {
+	parts := strings.Split(outpoint, ":")
+	if len(parts) != 2 {
+		return nil, 0, errBadOutpoint
+	}
+
+	txid, err := hex.DecodeString(parts[0])
+	if err != nil || len(txid) == 0 {
+		return nil, 0, errBadOutpoint
+	}
+
+	vout, err := strconv.Atoi(parts[1])
+	if err != nil || vout < 0 {
+		return nil, 0, errBadOutpoint
+	}
+
+	return txid, vout, nil
+}
+
+func utxoKey(utxo UTXO) string {
+	return utxo.TxStr + ":" + strconv.Itoa(utxo.OutInd)
+}
+
+func (wallets *NFC_Wallets) IsLockedUnspent(utxo UTXO) bool {
+	return wallets.LockedUnspent[utxoKey(utxo)]
+}
+
+// LockUnspent locks, or unlocks, the given outpoints. Only unspent outputs
+// of the wallet can be locked and only locked ones unlocked, nothing
+// changes if one of them can't.
+func (wallets *NFC_Wallets) LockUnspent(outpoints []string, lock bool, utxoset *UTXOSet) error {
+	keys := []string{}
+	for _, outpoint := range outpoints {
+		key, err := ParseOutpoint(outpoint)
+		if err != nil {
+			return err
+		}
+
+		if lock {
+			utxo, ok := utxoset.FindOutpoint(key)
+			if !ok || wallets.Ownership(utxo.Output.PubKeyHash) == NotMine {
+				return errNotWalletOutpoint
+			}
+		} else if !wallets.LockedUnspent[key] {
+			return errNotLocked
+		}
+
+		keys = append(keys, key)
+	}
+
+	err := wallets.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(lockedUnspentBucket))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if lock {
+				err = b.Put([]byte(key), []byte{1})
+			} else {
+				err = b.Delete([]byte(key))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if lock {
+			wallets.LockedUnspent[key] = true
+		} else {
+			delete(wallets.LockedUnspent, key)
+		}
+	}
+
+	return nil
+}
+
+// UnlockAllUnspent clears every lock.
+func (wallets *NFC_Wallets) UnlockAllUnspent() error {
+	err := wallets.update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(lockedUnspentBucket)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(lockedUnspentBucket))
+	})
+	if err != nil {
+		return err
+	}
+
+	wallets.LockedUnspent = make(map[string]bool)
+
+	return nil
+}
+
+// MempoolSpent returns the outpoints the mempool transactions spend.
+func (mp *Mempool) MempoolSpent() map[string]bool {
+	spent := make(map[string]bool)
+
+	for _, tx := range mp.Transactions() {
+		for _, in := range tx.Vin {
+			spent[outpointKey(in.Txid, in.Vout)] = true
+		}
+	}
+
+	return spent
+}
+
+// AvailableUTXOs drops what automatic selection mustn't spend: locked
+// outputs and outputs a mempool transaction already spends.
+func AvailableUTXOs(utxos []UTXO, mempool *Mempool) []UTXO {
+	spent := mempool.MempoolSpent()
+
+	available := []UTXO{}
+	for _, utxo := range utxos {
+		if Nfc_wallets.IsLockedUnspent(utxo) || spent[utxoKey(utxo)] {
+			continue
+		}
+		available = append(available, utxo)
+	}
+
+	return available
+}
+
+// SelectInputs returns exactly the outputs of address named by outpoints.
+func SelectInputs(address string, outpoints []string, utxoset *UTXOSet, mempool *Mempool) ([]UTXO, error) {
+	utxos := make(map[string]UTXO)
+	for _, utxo := range utxoset.FindUTXO(address) {
+		utxos[utxoKey(utxo)] = utxo
+	}
+
+	spent := mempool.MempoolSpent()
+
+	selected := []UTXO{}
+	seen := make(map[string]bool)
+	for _, outpoint := range outpoints {
+		key, err := ParseOutpoint(outpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		utxo, ok := utxos[key]
+		if !ok {
+			return nil, errUnknownOutpoint
+		}
+		if spent[key] {
+			return nil, errOutpointInMempool
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			selected = append(selected, utxo)
+		}
+	}
+
+	return selected, nil
+}
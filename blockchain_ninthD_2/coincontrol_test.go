@@ -0,0 +1,105 @@
+package main
+
+import "testing"
+import "os"
+import "encoding/hex"
+
+func TestLockUnspentPersists(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	LoadWallets()
+	w := NewWallet()
+	if err := Nfc_wallets.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Nfc_wallets.Wallets = make(map[string]*Wallet) }()
+
+	first := UTXO{"aaaa", 0, TxOutput{5, HashPubKey(w.PublicKey)}}
+	second := UTXO{"bbbb", 3, TxOutput{7, HashPubKey(w.PublicKey)}}
+	foreign := UTXO{"cccc", 1, TxOutput{9, []byte{0x11}}}
+	utxoset := &UTXOSet{"NFC_UTXOset", "utxoset", map[string][]UTXO{
+		hex.EncodeToString(HashPubKey(w.PublicKey)): {first, second},
+		"11": {foreign},
+	}}
+
+	if err := Nfc_wallets.LockUnspent([]string{"aaaa:0", "bbbb:3"}, true, utxoset); err != nil {
+		t.Fatal(err)
+	}
+
+	LoadWallets()
+	if !Nfc_wallets.IsLockedUnspent(first) || !Nfc_wallets.IsLockedUnspent(second) {
+		t.Fatalf("locks after reloading: %v", Nfc_wallets.LockedUnspent)
+	}
+
+	// none of the outpoints is locked when one of them is refused
+	for _, outpoints := range [][]string{{"aaaa:1"}, {"cccc:1"}, {"aaaa:0", "dddd:0"}} {
+		if err := Nfc_wallets.LockUnspent(outpoints, true, utxoset); err != errNotWalletOutpoint {
+			t.Errorf("locking %v: got %v, want %v", outpoints, err, errNotWalletOutpoint)
+		}
+	}
+	if err := Nfc_wallets.LockUnspent([]string{"aaaa:0", "cccc:1"}, false, utxoset); err != errNotLocked {
+		t.Errorf("unlocking an outpoint that isn't locked: got %v, want %v", err, errNotLocked)
+	}
+	if len(Nfc_wallets.LockedUnspent) != 2 {
+		t.Fatalf("locks after refused calls: %v", Nfc_wallets.LockedUnspent)
+	}
+
+	if err := Nfc_wallets.LockUnspent([]string{"aaaa:0"}, false, utxoset); err != nil {
+		t.Fatal(err)
+	}
+
+	LoadWallets()
+	if Nfc_wallets.IsLockedUnspent(first) || !Nfc_wallets.IsLockedUnspent(second) {
+		t.Fatalf("locks after unlocking one: %v", Nfc_wallets.LockedUnspent)
+	}
+
+	if err := Nfc_wallets.UnlockAllUnspent(); err != nil {
+		t.Fatal(err)
+	}
+
+	LoadWallets()
+	if len(Nfc_wallets.LockedUnspent) != 0 {
+		t.Fatalf("locks after unlocking all: %v", Nfc_wallets.LockedUnspent)
+	}
+}
+
+func TestLockUnspentWalletFileError(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	LoadWallets()
+	w := NewWallet()
+	if err := Nfc_wallets.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { Nfc_wallets.Wallets = make(map[string]*Wallet) }()
+
+	utxo := UTXO{"aaaa", 0, TxOutput{5, HashPubKey(w.PublicKey)}}
+	utxoset := &UTXOSet{"NFC_UTXOset", "utxoset", map[string][]UTXO{hex.EncodeToString(HashPubKey(w.PublicKey)): {utxo}}}
+
+	// a directory in place of the wallet file can't be opened
+	if err := os.Remove(walletsFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(walletsFile, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Nfc_wallets.LockUnspent([]string{"aaaa:0"}, true, utxoset); err == nil {
+		t.Error("locked without a wallet file")
+	}
+	if Nfc_wallets.IsLockedUnspent(utxo) {
+		t.Error("locked in memory without a wallet file")
+	}
+}
+
+func TestParseOutpoint(t *testing.T) {
+	if key, err := ParseOutpoint("aabb:2"); err != nil || key != outpointKey([]byte{0xaa, 0xbb}, 2) {
+		t.Errorf("got %q, %v", key, err)
+	}
+
+	for _, outpoint := range []string{"", "aabb", ":2", "aabb:", "aabb:-1", "zz:2", "aabb:2:3"} {
+		if _, err := ParseOutpoint(outpoint); err != errBadOutpoint {
+			t.Errorf("%q: got %v, want %v", outpoint, err, errBadOutpoint)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import "errors"
+import "math/rand"
+import "sort"
+
+// coin selection picks which outputs pay for a transaction. Every
+// selector returns the total and the outputs chosen; a total below the
+// amount means the outputs can't cover it.
+
+var errUnknownCoinSelector = errors.New("unknown coin selection strategy")
+
+// tries before branch and bound gives up looking for an exact match
+const bnbMaxTries = 100000
+
+type CoinSelector interface {
+	Name() string
+	Select(utxos []UTXO, amount Amount) (Amount, []UTXO)
+}
+
+type branchAndBound struct{}
+type largestFirst struct{}
+type smallestFirst struct{}
+type randomSelector struct{}
+
+var coinSelectors = map[string]CoinSelector{
+	"bnb":      branchAndBound{},
+	"largest":  largestFirst{},
+	"smallest": smallestFirst{},
+	"random":   randomSelector{},
+}
+
+const DefaultCoinSelector = "bnb"
+
+func GetCoinSelector(name string) (CoinSelector, error) {
+	selector, ok := coinSelectors[name]
+	if !ok {
+		return nil, errUnknownCoinSelector
+	}
+	return selector, nil
+}
+
+// takeInOrder takes utxos in order until amount is covered. An output
+// that would take the total past MaxMoney is passed over.
+func takeInOrder(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	useUtxo := []UTXO{}
+	var sum Amount
+
+	if amount <= 0 {
+		return 0, useUtxo
+	}
+
+	for _, out := range utxos {
+		next, err := sum.Add(out.Output.Value)
+		if err != nil {
+			continue
+		}
+		sum = next
+		useUtxo = append(useUtxo, out)
+		if sum >= amount {
+			break
+		}
+	}
+
+	return sum, useUtxo
+}
+
+func sortedByValue(utxos []UTXO, descending bool) []UTXO {
+	sorted := append([]UTXO{}, utxos...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Output.Value > sorted[j].Output.Value
+		}
+		return sorted[i].Output.Value < sorted[j].Output.Value
+	})
+
+	return sorted
+}
+
+func (largestFirst) Name() string { return "largest" }
+
+// Select spends the fewest outputs, leaving the small ones as they are.
+func (largestFirst) Select(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	return takeInOrder(sortedByValue(utxos, true), amount)
+}
+
+func (smallestFirst) Name() string { return "smallest" }
+
+// Select consolidates dust, at the price of bigger transactions.
+func (smallestFirst) Select(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	return takeInOrder(sortedByValue(utxos, false), amount)
+}
+
+func (randomSelector) Name() string { return "random" }
+
+// Select takes outputs in random order, so which coins are spent together
+// says less about who owns them.
+func (randomSelector) Select(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	shuffled := append([]UTXO{}, utxos...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return takeInOrder(shuffled, amount)
+}
+
+func (branchAndBound) Name() string { return "bnb" }
+
+// Select looks for outputs adding up to exactly amount, which needs no
+// change output. Without one within bnbMaxTries it falls back to largest
+// first.
+func (branchAndBound) Select(utxos []UTXO, amount Amount) (Amount, []UTXO) {
+	if amount <= 0 {
+		return 0, []UTXO{}
+	}
+
+	sorted := sortedByValue(utxos, true)
+
+	// remaining[i] is what sorted[i:] adds up to
+	remaining := make([]Amount, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+
+	chosen := []int{}
+	tries := 0
+
+	var search func(i int, sum Amount) bool
+	search = func(i int, sum Amount) bool {
+		if sum == amount {
+			return true
+		}
+		if sum > amount || i == len(sorted) || sum+remaining[i] < amount || tries >= bnbMaxTries {
+			return false
+		}
+		tries++
+
+		chosen = append(chosen, i)
+		if search(i+1, sum+sorted[i].Output.Value) {
+			return true
+		}
+		chosen = chosen[:len(chosen)-1]
+
+		// leaving out an output worth the same as one just left out
+		// can't find anything new
+		next := i + 1
+		for next < len(sorted) && sorted[next].Output.Value == sorted[i].Output.Value {
+			next++
+		}
+		return search(next, sum)
+	}
+
+	if !search(0, 0) {
+		return largestFirst{}.Select(utxos, amount)
+	}
+
+	useUtxo := []UTXO{}
+	for _, i := range chosen {
+		useUtxo = append(useUtxo, sorted[i])
+	}
+
+	return amount, useUtxo
+}
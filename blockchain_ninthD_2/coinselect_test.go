@@ -0,0 +1,138 @@
+package main
+
+import "testing"
+
+func coinSelectTestUTXOs(values ...Amount) []UTXO {
+	utxos := []UTXO{}
+	for outInd, value := range values {
+		utxos = append(utxos, UTXO{"aa", outInd, TxOutput{value, []byte{0x11}}})
+	}
+	return utxos
+}
+
+// checkSelection checks that chosen are distinct outputs of utxos worth
+// total together.
+func checkSelection(t *testing.T, name string, utxos []UTXO, total Amount, chosen []UTXO) {
+	seen := make(map[int]bool)
+	var sum Amount
+	for _, utxo := range chosen {
+		if seen[utxo.OutInd] {
+			t.Fatalf("%s: output %d chosen twice", name, utxo.OutInd)
+		}
+		seen[utxo.OutInd] = true
+
+		if utxo.OutInd >= len(utxos) || utxos[utxo.OutInd].Output.Value != utxo.Output.Value {
+			t.Fatalf("%s: output %d isn't one of the utxos", name, utxo.OutInd)
+		}
+		sum += utxo.Output.Value
+	}
+	if sum != total {
+		t.Fatalf("%s: outputs worth %s, total says %s", name, sum, total)
+	}
+}
+
+func TestBranchAndBoundExactMatch(t *testing.T) {
+	utxos := coinSelectTestUTXOs(5, 3, 2, 7)
+
+	total, chosen := branchAndBound{}.Select(utxos, 10)
+	if total != 10 {
+		t.Fatalf("total %s, want 10", total)
+	}
+	checkSelection(t, "bnb", utxos, total, chosen)
+}
+
+func TestBranchAndBoundFallsBack(t *testing.T) {
+	utxos := coinSelectTestUTXOs(4, 9, 4)
+
+	total, chosen := branchAndBound{}.Select(utxos, 6)
+	wantTotal, wantChosen := largestFirst{}.Select(utxos, 6)
+
+	if total != wantTotal || len(chosen) != len(wantChosen) {
+		t.Fatalf("got %s in %d outputs, largest first gives %s in %d", total, len(chosen), wantTotal, len(wantChosen))
+	}
+	if total != 9 || chosen[0].OutInd != 1 {
+		t.Fatalf("got %s from %v, want the output worth 9", total, chosen)
+	}
+	checkSelection(t, "bnb", utxos, total, chosen)
+}
+
+func TestBranchAndBoundDuplicateValues(t *testing.T) {
+	utxos := coinSelectTestUTXOs(3, 3, 3, 3)
+
+	total, chosen := branchAndBound{}.Select(utxos, 6)
+	if total != 6 || len(chosen) != 2 {
+		t.Fatalf("got %s in %d outputs, want 6 in 2", total, len(chosen))
+	}
+	checkSelection(t, "bnb", utxos, total, chosen)
+
+	// no exact match, largest first takes three
+	total, chosen = branchAndBound{}.Select(utxos, 7)
+	if total != 9 || len(chosen) != 3 {
+		t.Fatalf("got %s in %d outputs, want 9 in 3", total, len(chosen))
+	}
+	checkSelection(t, "bnb", utxos, total, chosen)
+}
+
+// an odd amount out of even outputs has no exact match, and there are far
+// more subsets to try than bnbMaxTries: without the cutoff this wouldn't
+// return
+func TestBranchAndBoundMaxTries(t *testing.T) {
+	values := []Amount{}
+	for i := 0; i < 60; i++ {
+		values = append(values, Coin+Amount(2*i))
+	}
+	utxos := coinSelectTestUTXOs(values...)
+	// 30 outputs add up to between 30*Coin+870 and 30*Coin+2670
+	amount := 30*Coin + 1771
+
+	total, chosen := branchAndBound{}.Select(utxos, amount)
+	wantTotal, wantChosen := largestFirst{}.Select(utxos, amount)
+
+	if total != wantTotal || len(chosen) != len(wantChosen) {
+		t.Fatalf("got %s in %d outputs, largest first gives %s in %d", total, len(chosen), wantTotal, len(wantChosen))
+	}
+	checkSelection(t, "bnb", utxos, total, chosen)
+}
+
+func TestCoinSelectorsNothingToSelect(t *testing.T) {
+	for name, selector := range coinSelectors {
+		for _, amount := range []Amount{0, -1, -Coin} {
+			total, chosen := selector.Select(coinSelectTestUTXOs(1, 2, 3), amount)
+			if total != 0 || len(chosen) != 0 {
+				t.Errorf("%s: amount %s selected %s in %d outputs", name, amount, total, len(chosen))
+			}
+		}
+
+		total, chosen := selector.Select([]UTXO{}, 5)
+		if total != 0 || len(chosen) != 0 {
+			t.Errorf("%s: no utxos selected %s in %d outputs", name, total, len(chosen))
+		}
+	}
+}
+
+func TestCoinSelectorsNotEnough(t *testing.T) {
+	utxos := coinSelectTestUTXOs(1, 2, 3)
+
+	for name, selector := range coinSelectors {
+		total, chosen := selector.Select(utxos, 7)
+		if total != 6 {
+			t.Errorf("%s: total %s, want every output, 6", name, total)
+		}
+		checkSelection(t, name, utxos, total, chosen)
+	}
+}
+
+func TestGetCoinSelector(t *testing.T) {
+	for name := range coinSelectors {
+		selector, err := GetCoinSelector(name)
+		if err != nil || selector.Name() != name {
+			t.Errorf("%s: got %v, %v", name, selector, err)
+		}
+	}
+
+	for _, name := range []string{"", "fifo", "BNB"} {
+		if _, err := GetCoinSelector(name); err != errUnknownCoinSelector {
+			t.Errorf("%q: got %v, want %v", name, err, errUnknownCoinSelector)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import "fmt"
+import "encoding/hex"
+
+// the consensus rules every block must follow, whoever mined it. These
+// checks need no chain but CheckNewTransactions, CheckInputsUnspent and
+// CheckCoinbaseValue take what they need of it. The signatures are checked
+// by VerifyTransactions.
+
+// a block holds at most MaxBlockSize bytes, header included, at most
+// MaxBlockTransactions transactions and MaxBlockSigOps signature checks.
+// Sizes are counted in the consensus encoding, BlockHeaderSize plus the
+// encoding each transaction Hash is computed over, not in the gob bytes a
+// block is stored as: those carry gob type descriptors and change with
+// the Go types.
+const MaxBlockSize = 1000000
+const MaxBlockTransactions = 10000
+const MaxBlockSigOps = 20000
+
+type RuleCode int
+
+const (
+	RuleBlockSize RuleCode = iota + 1
+	RuleTxCount
+	RuleSigOps
+	RuleDuplicateTx
+	RuleFirstNotCoinbase
+	RuleExtraCoinbase
+	RuleNoOutputs
+	RuleNegativeOutput
+	RuleOutputTooLarge
+	RuleOutputsOverflow
+	RuleDuplicateInput
+	RuleOutputsExceedInputs
+	RuleCoinbaseValue
+	RuleMissingInput
+)
+
+var ruleNames = map[RuleCode]string{
+	RuleBlockSize:        "block-size",
+	RuleTxCount:          "tx-count",
+	RuleSigOps:           "sigops",
+	RuleDuplicateTx:      "duplicate-tx",
+	RuleFirstNotCoinbase: "first-not-coinbase",
+	RuleExtraCoinbase:    "extra-coinbase",
+	RuleNoOutputs:        "no-outputs",
+	RuleNegativeOutput:   "negative-output",
+	RuleOutputTooLarge:   "output-too-large",
+	RuleOutputsOverflow:  "outputs-overflow",
+	RuleDuplicateInput:   "duplicate-input",
+
+	RuleOutputsExceedInputs: "outputs-exceed-inputs",
+	RuleCoinbaseValue:       "coinbase-value",
+	RuleMissingInput:        "missing-input",
+}
+
+func (code RuleCode) String() string {
+	return ruleNames[code]
+}
+
+// RuleError is a broken consensus rule.
+type RuleError struct {
+	Code RuleCode
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("consensus rule %d (%s): %s", int(e.Code), e.Code, e.Msg)
+}
+
+func ruleError(code RuleCode, format string, args ...interface{}) error {
+	return &RuleError{code, fmt.Sprintf(format, args...)}
+}
+
+// SigOps counts the signature checks tx needs, one per input.
+func (tx *Transaction) SigOps() int {
+	return len(tx.Vin)
+}
+
+// Size is the consensus size of the block, see MaxBlockSize. It is not
+// len(block.SerializeBlock()).
+func (block *Block) Size() int {
+	return blockSize(block.Transactions)
+}
+
+func blockSize(txs []*Transaction) int {
+	size := BlockHeaderSize
+	for _, tx := range txs {
+		size += tx.Size()
+	}
+	return size
+}
+
+func CheckBlock(block *Block) error {
+	return CheckBlockTransactions(block.Transactions)
+}
+
+// CheckBlockTransactions checks the transactions of a block: the limits,
+// exactly one coinbase, first, no transaction twice and every transaction
+// on its own.
+func CheckBlockTransactions(txs []*Transaction) error {
+	if len(txs) > MaxBlockTransactions {
+		return ruleError(RuleTxCount, "%d transactions, at most %d", len(txs), MaxBlockTransactions)
+	}
+
+	if size := blockSize(txs); size > MaxBlockSize {
+		return ruleError(RuleBlockSize, "%d bytes, at most %d", size, MaxBlockSize)
+	}
+
+	if len(txs) == 0 || !txs[0].IsCoinbase() {
+		return ruleError(RuleFirstNotCoinbase, "the first transaction must be the coinbase")
+	}
+
+	sigOps := 0
+	seen := make(map[string]bool)
+	for txInd, tx := range txs {
+		txStr := hex.EncodeToString(tx.ID)
+
+		if txInd > 0 && tx.IsCoinbase() {
+			return ruleError(RuleExtraCoinbase, "transaction %d, %s, is a second coinbase", txInd, txStr)
+		}
+
+		if seen[txStr] {
+			return ruleError(RuleDuplicateTx, "transaction %s is in the block twice", txStr)
+		}
+		seen[txStr] = true
+
+		if err := CheckTransaction(tx); err != nil {
+			return err
+		}
+
+		sigOps += tx.SigOps()
+	}
+
+	if sigOps > MaxBlockSigOps {
+		return ruleError(RuleSigOps, "%d signature checks, at most %d", sigOps, MaxBlockSigOps)
+	}
+
+	return nil
+}
+
+// CheckNewTransactions checks that none of txs is already in the chain,
+// the ID of a transaction is what its outputs are spent by.
+func (bc *BlockChain) CheckNewTransactions(txs []*Transaction) error {
+	wanted := make(map[string]bool)
+	for _, tx := range txs {
+		wanted[hex.EncodeToString(tx.ID)] = true
+	}
+
+	bci := NewBlockchainIterator(bc)
+	for len(bci.currentHash) > 0 {
+		block := bci.Next()
+
+		for _, blockTx := range block.Transactions {
+			txStr := hex.EncodeToString(blockTx.ID)
+			if wanted[txStr] {
+				return ruleError(RuleDuplicateTx, "transaction %s is already in the chain", txStr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckInputsUnspent checks that every input of txs, in block order,
+// spends an output of unspent or of an earlier transaction of txs, and
+// that no two inputs spend the same one. It returns the outputs spent.
+func CheckInputsUnspent(txs []*Transaction, unspent map[string]TxOutput) (map[string]TxOutput, error) {
+	prevOuts := make(map[string]TxOutput)
+	created := make(map[string]TxOutput)
+
+	for _, tx := range txs {
+		for inInd, in := range tx.Vin {
+			key := outpointKey(in.Txid, in.Vout)
+
+			out, ok := created[key]
+			if !ok {
+				out, ok = unspent[key]
+			}
+			if _, spent := prevOuts[key]; !ok || spent {
+				return nil, ruleError(RuleMissingInput, "input %d of %s spends %s, which is spent or doesn't exist", inInd, hex.EncodeToString(tx.ID), key)
+			}
+			prevOuts[key] = out
+		}
+
+		for outInd, out := range tx.Vout {
+			created[outpointKey(tx.ID, outInd)] = out
+		}
+	}
+
+	return prevOuts, nil
+}
+
+// CheckCoinbaseValue checks that no transaction of a block pays out more
+// than it spends and that the coinbase, first, pays at most BlockReward
+// plus their fees. prevOuts holds the outputs spent, as
+// FindPreviousOutputs returns them.
+func CheckCoinbaseValue(txs []*Transaction, prevOuts map[string]TxOutput) error {
+	allowed := BlockReward
+	for _, tx := range txs[1:] {
+		fee, err := TxFee(tx, prevOuts)
+		if err != nil {
+			return err
+		}
+		if fee < 0 {
+			return ruleError(RuleOutputsExceedInputs, "transaction %s pays out %s more than it spends", hex.EncodeToString(tx.ID), -fee)
+		}
+
+		if allowed, err = allowed.Add(fee); err != nil {
+			return ruleError(RuleCoinbaseValue, "the fees are worth more than %s", MaxMoney)
+		}
+	}
+
+	var paid Amount
+	for _, out := range txs[0].Vout {
+		paid += out.Value
+	}
+	if paid > allowed {
+		return ruleError(RuleCoinbaseValue, "the coinbase pays %s, at most %s", paid, allowed)
+	}
+
+	return nil
+}
+
+// CheckTransaction checks what can be checked of tx on its own: it has
+// outputs, each worth 0 to MaxMoney and MaxMoney at most together, and it
+// spends no output twice. A coinbase may have no outputs, when it is
+// mined for fees and there are none.
+func CheckTransaction(tx *Transaction) error {
+	txStr := hex.EncodeToString(tx.ID)
+
+	if len(tx.Vout) == 0 && !tx.IsCoinbase() {
+		return ruleError(RuleNoOutputs, "transaction %s has no outputs", txStr)
+	}
+
+	var total Amount
+	for outInd, out := range tx.Vout {
+		if out.Value < 0 {
+			return ruleError(RuleNegativeOutput, "output %d of %s is worth %s", outInd, txStr, out.Value)
+		}
+		if out.Value > MaxMoney {
+			return ruleError(RuleOutputTooLarge, "output %d of %s is worth %s, at most %s", outInd, txStr, out.Value, MaxMoney)
+		}
+
+		var err error
+		if total, err = total.Add(out.Value); err != nil {
+			return ruleError(RuleOutputsOverflow, "the outputs of %s are worth more than %s", txStr, MaxMoney)
+		}
+	}
+
+	spent := make(map[string]bool)
+	for inInd, in := range tx.Vin {
+		key := outpointKey(in.Txid, in.Vout)
+		if spent[key] {
+			return ruleError(RuleDuplicateInput, "input %d of %s spends %s again", inInd, txStr, key)
+		}
+		spent[key] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import "testing"
+import "bytes"
+import "errors"
+
+var consensusTestPubKeyHash = bytes.Repeat([]byte{0x11}, pubKeyHashLen)
+
+func consensusTestTx(id byte, inputs int, values ...Amount) *Transaction {
+	tx := &Transaction{[]byte{id}, []TxInput{}, []TxOutput{}}
+	for vout := 0; vout < inputs; vout++ {
+		tx.Vin = append(tx.Vin, TxInput{[]byte{0xee, id}, vout, []byte{}, []byte{}, SequenceFinal})
+	}
+	for _, value := range values {
+		tx.Vout = append(tx.Vout, TxOutput{value, consensusTestPubKeyHash})
+	}
+	return tx
+}
+
+func ruleCode(err error) RuleCode {
+	var ruleErr *RuleError
+	if errors.As(err, &ruleErr) {
+		return ruleErr.Code
+	}
+	return 0
+}
+
+func TestCheckBlockTransactions(t *testing.T) {
+	coinbase := consensusTestTx(0xc0, 0, BlockReward)
+	spend := consensusTestTx(0x01, 1, Coin)
+
+	manyTxs := []*Transaction{coinbase}
+	for i := 0; i < MaxBlockTransactions; i++ {
+		manyTxs = append(manyTxs, consensusTestTx(0x02, 1, Coin))
+		manyTxs[len(manyTxs)-1].ID = []byte{byte(i >> 8), byte(i)}
+	}
+
+	bigTx := consensusTestTx(0x03, 1, Coin)
+	bigTx.Vout[0].PubKeyHash = make([]byte, MaxBlockSize)
+
+	duplicateInput := consensusTestTx(0x04, 2, Coin)
+	duplicateInput.Vin[1].Vout = 0
+
+	tests := []struct {
+		name string
+		txs  []*Transaction
+		code RuleCode
+	}{
+		{"valid", []*Transaction{coinbase, spend}, 0},
+		{"coinbase only", []*Transaction{coinbase}, 0},
+		{"coinbase without outputs", []*Transaction{consensusTestTx(0xc1, 0), spend}, 0},
+		{"too many transactions", manyTxs, RuleTxCount},
+		{"too big", []*Transaction{coinbase, bigTx}, RuleBlockSize},
+		{"too many signature checks", []*Transaction{coinbase, consensusTestTx(0x05, MaxBlockSigOps+1, Coin)}, RuleSigOps},
+		{"same transaction twice", []*Transaction{coinbase, spend, spend}, RuleDuplicateTx},
+		{"empty", []*Transaction{}, RuleFirstNotCoinbase},
+		{"coinbase second", []*Transaction{spend, coinbase}, RuleFirstNotCoinbase},
+		{"two coinbases", []*Transaction{coinbase, consensusTestTx(0xc1, 0, Coin)}, RuleExtraCoinbase},
+		{"no outputs", []*Transaction{coinbase, consensusTestTx(0x06, 1)}, RuleNoOutputs},
+		{"negative output", []*Transaction{coinbase, consensusTestTx(0x07, 1, -1)}, RuleNegativeOutput},
+		{"output above max money", []*Transaction{coinbase, consensusTestTx(0x08, 1, MaxMoney+1)}, RuleOutputTooLarge},
+		{"outputs above max money", []*Transaction{coinbase, consensusTestTx(0x09, 1, MaxMoney, 1)}, RuleOutputsOverflow},
+		{"output spent twice", []*Transaction{coinbase, duplicateInput}, RuleDuplicateInput},
+	}
+
+	for _, test := range tests {
+		err := CheckBlockTransactions(test.txs)
+		if code := ruleCode(err); code != test.code || (test.code == 0) != (err == nil) {
+			t.Errorf("%s: got %v, want rule %d (%s)", test.name, err, test.code, test.code)
+		}
+	}
+}
+
+func TestCheckCoinbaseValue(t *testing.T) {
+	// each spends an output worth 2 coins
+	paysFee := consensusTestTx(0x01, 1, Coin)
+	paysNoFee := consensusTestTx(0x02, 1, 2*Coin)
+	paysTooMuch := consensusTestTx(0x03, 1, 3*Coin)
+
+	prevOuts := make(map[string]TxOutput)
+	for _, tx := range []*Transaction{paysFee, paysNoFee, paysTooMuch} {
+		prevOuts[outpointKey(tx.Vin[0].Txid, 0)] = TxOutput{2 * Coin, consensusTestPubKeyHash}
+	}
+
+	tests := []struct {
+		name string
+		txs  []*Transaction
+		code RuleCode
+	}{
+		{"reward", []*Transaction{consensusTestTx(0xc0, 0, BlockReward)}, 0},
+		{"reward and fee", []*Transaction{consensusTestTx(0xc0, 0, BlockReward, Coin), paysFee}, 0},
+		{"less than allowed", []*Transaction{consensusTestTx(0xc0, 0, Coin), paysFee, paysNoFee}, 0},
+		{"nothing", []*Transaction{consensusTestTx(0xc0, 0), paysNoFee}, 0},
+		{"above the reward", []*Transaction{consensusTestTx(0xc0, 0, BlockReward+1)}, RuleCoinbaseValue},
+		{"above reward and fee", []*Transaction{consensusTestTx(0xc0, 0, BlockReward, Coin+1), paysFee}, RuleCoinbaseValue},
+		{"outputs above inputs", []*Transaction{consensusTestTx(0xc0, 0, BlockReward), paysTooMuch}, RuleOutputsExceedInputs},
+	}
+
+	for _, test := range tests {
+		err := CheckCoinbaseValue(test.txs, prevOuts)
+		if code := ruleCode(err); code != test.code || (test.code == 0) != (err == nil) {
+			t.Errorf("%s: got %v, want rule %d (%s)", test.name, err, test.code, test.code)
+		}
+	}
+
+	unknown := consensusTestTx(0x04, 1, Coin)
+	unknown.Vin[0].Txid = []byte{0xdd}
+	if err := CheckCoinbaseValue([]*Transaction{consensusTestTx(0xc0, 0), unknown}, prevOuts); err != errMissingPrevOutput {
+		t.Errorf("unknown output spent: got %v, want %v", err, errMissingPrevOutput)
+	}
+}
+
+func TestRuleCodeNames(t *testing.T) {
+	seen := make(map[string]bool)
+	for code := RuleBlockSize; code <= RuleMissingInput; code++ {
+		name := code.String()
+		if name == "" || seen[name] {
+			t.Errorf("rule %d has name %q", code, name)
+		}
+		seen[name] = true
+	}
+
+	// the codes are printed and compared by peers, they mustn't move
+	if RuleBlockSize != 1 || RuleDuplicateInput != 11 || RuleCoinbaseValue != 13 || RuleMissingInput != 14 {
+		t.Errorf("rule codes were renumbered")
+	}
+
+	err := ruleError(RuleDuplicateTx, "transaction %s twice", "aa")
+	if err.Error() != "consensus rule 4 (duplicate-tx): transaction aa twice" {
+		t.Errorf("got %q", err.Error())
+	}
+}
+
+func TestCheckInputsUnspent(t *testing.T) {
+	unspent := map[string]TxOutput{outpointKey([]byte{0xee, 0x01}, 0): {Coin, consensusTestPubKeyHash}}
+
+	coinbase := consensusTestTx(0xc0, 0, BlockReward)
+	spend := consensusTestTx(0x01, 1, Coin)
+	child := &Transaction{[]byte{0x02}, []TxInput{{spend.ID, 0, []byte{}, []byte{}, SequenceFinal}}, []TxOutput{{Coin, consensusTestPubKeyHash}}}
+	doubleSpend := consensusTestTx(0x01, 1, Coin)
+	doubleSpend.ID = []byte{0x03}
+
+	prevOuts, err := CheckInputsUnspent([]*Transaction{coinbase, spend, child}, unspent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prevOuts) != 2 {
+		t.Errorf("%d outputs spent, want 2", len(prevOuts))
+	}
+
+	tests := []struct {
+		name string
+		txs  []*Transaction
+	}{
+		{"child first", []*Transaction{coinbase, child, spend}},
+		{"double spend", []*Transaction{coinbase, spend, doubleSpend}},
+		{"missing", []*Transaction{coinbase, consensusTestTx(0x04, 2, Coin)}},
+	}
+	for _, test := range tests {
+		if _, err := CheckInputsUnspent(test.txs, unspent); ruleCode(err) != RuleMissingInput {
+			t.Errorf("%s: got %v, want rule %d", test.name, err, RuleMissingInput)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import "bytes"
+import "errors"
+import "io"
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/rand"
+import "encoding/gob"
+import "golang.org/x/crypto/scrypt"
+
+// scrypt cost parameters for new passphrases
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// known plaintext sealed with the key, to tell a wrong passphrase apart
+const crypterCheck = "nfc wallet"
+
+var errWrongPassphrase = errors.New("wrong passphrase")
+var errWalletLocked = errors.New("the wallet is locked")
+var errWalletEncrypted = errors.New("the wallet is already encrypted")
+var errWalletNotEncrypted = errors.New("the wallet isn't encrypted")
+
+// WalletCrypter holds the scrypt parameters the wallet key is derived with.
+// The derived key itself only lives in memory while the wallet is unlocked.
+type WalletCrypter struct {
+	Salt  []byte
+	N     int
+	R     int
+	P     int
+	Check []byte
+
+	key []byte
+}
+
+func NewWalletCrypter(passphrase string) (*WalletCrypter, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	crypter := &WalletCrypter{Salt: salt, N: scryptN, R: scryptR, P: scryptP}
+
+	key, err := crypter.DeriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	crypter.Check, err = sealWithKey(key, []byte(crypterCheck))
+	if err != nil {
+		return nil, err
+	}
+
+	// a new crypter starts unlocked, the caller encrypts with it
+	crypter.key = key
+
+	return crypter, nil
+}
+
+func (crypter *WalletCrypter) DeriveKey(passphrase string) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), crypter.Salt, crypter.N, crypter.R, crypter.P, 32)
+}
+
+// CheckKey reports whether key was derived from the right passphrase.
+func (crypter *WalletCrypter) CheckKey(key []byte) bool {
+	plaintext, err := openWithKey(key, crypter.Check)
+
+	return err == nil && string(plaintext) == crypterCheck
+}
+
+func (crypter *WalletCrypter) Seal(plaintext []byte) ([]byte, error) {
+	if crypter.key == nil {
+		return nil, errWalletLocked
+	}
+	return sealWithKey(crypter.key, plaintext)
+}
+
+func (crypter *WalletCrypter) Open(ciphertext []byte) ([]byte, error) {
+	if crypter.key == nil {
+		return nil, errWalletLocked
+	}
+	return openWithKey(crypter.key, ciphertext)
+}
+
+// sealWithKey encrypts with AES-256-GCM, the nonce is prepended.
+func sealWithKey(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openWithKey(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errWrongPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (crypter *WalletCrypter) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(crypter)
+
+	return result.Bytes()
+}
+
+func DeserializeWalletCrypter(buffer []byte) *WalletCrypter {
+	var crypter WalletCrypter
+
+	decoder := gob.NewDecoder(bytes.NewReader(buffer))
+
+	_ = decoder.Decode(&crypter)
+
+	return &crypter
+}
@@ -0,0 +1,136 @@
+package main
+
+import "encoding/binary"
+import "github.com/boltdb/bolt"
+import "github.com/btcsuite/btcutil/gcs"
+
+// compact block filters, BIP158 style: one Golomb-coded set per block over
+// the output pubkey hashes and the outpoints spent by its inputs.
+const filtersBucket = "filters"
+
+const (
+	filterP = 19
+	filterM = 784931
+)
+
+// filterKey is the siphash key of a block's filter, the first 16 bytes
+// of the block hash.
+func filterKey(blockHash []byte) [gcs.KeySize]byte {
+	var key [gcs.KeySize]byte
+	copy(key[:], blockHash)
+
+	return key
+}
+
+// filterOutpoint is the filter entry of a spent output: txid | vout(4).
+func filterOutpoint(txid []byte, vout int) []byte {
+	var v [4]byte
+	binary.LittleEndian.PutUint32(v[:], uint32(vout))
+
+	return append(append([]byte{}, txid...), v[:]...)
+}
+
+func BuildBlockFilter(block *Block) (*gcs.Filter, error) {
+	entries := [][]byte{}
+	seen := make(map[string]bool)
+
+	add := func(entry []byte) {
+		if len(entry) > 0 && !seen[string(entry)] {
+			seen[string(entry)] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, tx := range block.Transactions {
+		for _, in := range tx.Vin {
+			add(filterOutpoint(in.Txid, in.Vout))
+		}
+		for _, out := range tx.Vout {
+			add(out.PubKeyHash)
+		}
+	}
+
+	return gcs.BuildGCSFilter(filterP, filterM, filterKey(block.Hash), entries)
+}
+
+func DeserializeBlockFilter(data []byte) (*gcs.Filter, error) {
+	return gcs.FromNBytes(filterP, filterM, data)
+}
+
+// MatchBlockFilter reports whether the filter of the block with blockHash
+// may contain any of entries. False positives are possible.
+func MatchBlockFilter(filter *gcs.Filter, blockHash []byte, entries [][]byte) bool {
+	if filter.N() == 0 || len(entries) == 0 {
+		return false
+	}
+
+	match, err := filter.MatchAny(filterKey(blockHash), entries)
+
+	return err == nil && match
+}
+
+func putBlockFilter(tx *bolt.Tx, block *Block) error {
+	filter, err := BuildBlockFilter(block)
+	if err != nil {
+		return err
+	}
+
+	data, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte(filtersBucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put(block.Hash, data)
+}
+
+// IndexFilters builds the filters of stored blocks that don't have one.
+func (bc *BlockChain) IndexFilters() {
+	blocks := []*Block{}
+
+	bci := NewBlockchainIterator(bc)
+	for {
+		block := bci.Next()
+
+		if _, found := bc.GetBlockFilter(block.Hash); found {
+			break
+		}
+		blocks = append(blocks, block)
+
+		if len(bci.currentHash) == 0 {
+			break
+		}
+	}
+
+	if len(blocks) == 0 {
+		return
+	}
+
+	_ = bc.db.Update(func(tx *bolt.Tx) error {
+		for _, block := range blocks {
+			if err := putBlockFilter(tx, block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetBlockFilter returns the serialized filter of the block with hash.
+func (bc *BlockChain) GetBlockFilter(hash []byte) ([]byte, bool) {
+	var data []byte
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(filtersBucket))
+		if b != nil {
+			data = append(data, b.Get(hash)...)
+		}
+		return nil
+	})
+
+	return data, data != nil
+}
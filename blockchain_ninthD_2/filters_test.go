@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+import "bytes"
+
+func filterTestBlock() *Block {
+	coinbase := &Transaction{[]byte{0xc0}, []TxInput{}, []TxOutput{{BlockReward, bytes.Repeat([]byte{0x11}, pubKeyHashLen)}}}
+	spend := &Transaction{[]byte{0x01}, []TxInput{{[]byte{0xee}, 2, []byte{}, []byte{}, SequenceFinal}}, []TxOutput{{Coin, bytes.Repeat([]byte{0x22}, pubKeyHashLen)}}}
+
+	return &Block{BlockHeader{}, []*Transaction{coinbase, spend}, bytes.Repeat([]byte{0xab}, 32)}
+}
+
+func TestBlockFilterMatch(t *testing.T) {
+	block := filterTestBlock()
+
+	filter, err := BuildBlockFilter(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entries [][]byte
+		want    bool
+	}{
+		{"output", [][]byte{bytes.Repeat([]byte{0x22}, pubKeyHashLen)}, true},
+		{"spent outpoint", [][]byte{filterOutpoint([]byte{0xee}, 2)}, true},
+		{"one of several", [][]byte{bytes.Repeat([]byte{0x33}, pubKeyHashLen), bytes.Repeat([]byte{0x11}, pubKeyHashLen)}, true},
+		{"absent address", [][]byte{bytes.Repeat([]byte{0x33}, pubKeyHashLen)}, false},
+		{"other output of the spent tx", [][]byte{filterOutpoint([]byte{0xee}, 3)}, false},
+		{"nothing", [][]byte{}, false},
+	}
+
+	for _, test := range tests {
+		if got := MatchBlockFilter(filter, block.Hash, test.entries); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBlockFilterRoundTrip(t *testing.T) {
+	block := filterTestBlock()
+
+	filter, err := BuildBlockFilter(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := filter.NBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DeserializeBlockFilter(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.N() != 3 {
+		t.Errorf("%d entries, want 3", decoded.N())
+	}
+
+	again, err := decoded.NBytes()
+	if err != nil || !bytes.Equal(again, data) {
+		t.Errorf("encoded again to %x, want %x", again, data)
+	}
+
+	if !MatchBlockFilter(decoded, block.Hash, [][]byte{bytes.Repeat([]byte{0x11}, pubKeyHashLen)}) {
+		t.Error("the decoded filter lost an entry")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import "errors"
+import "strconv"
+import "strings"
+import "math/big"
+import "crypto/hmac"
+import "crypto/sha512"
+import "crypto/elliptic"
+import "encoding/binary"
+import "github.com/btcsuite/btcd/btcec/v2"
+
+// hierarchical deterministic keys: BIP32 for the ECDSA and Schnorr
+// schemes, SLIP-10 for P-256 and Ed25519. Ed25519 only has hardened
+// children. An invalid BIP32 key is skipped, SLIP-10 derives an invalid
+// P-256 key again from the rejected hash instead.
+
+const HardenedKeyStart uint32 = 0x80000000
+
+var errInvalidChild = errors.New("derived key is invalid, use the next index")
+var errHardenedOnly = errors.New("this signature scheme only derives hardened keys")
+var errDerivationPath = errors.New("invalid derivation path")
+
+type ExtendedKey struct {
+	Version   byte
+	Key       []byte
+	ChainCode []byte
+	Depth     uint8
+	Index     uint32
+}
+
+// hdCurve holds what derivation needs to know about a scheme.
+type hdCurve struct {
+	seedKey      string
+	order        *big.Int
+	hardenedOnly bool
+	// SLIP-10 retries an invalid key, BIP32 gives up on it
+	retry bool
+	// compressed public key of a private key, for non hardened children
+	publicKey func(privateKey []byte) []byte
+}
+
+func getHDCurve(version byte) (*hdCurve, error) {
+	switch version {
+	case VersionP256:
+		curve := elliptic.P256()
+		return &hdCurve{"Nist256p1 seed", curve.Params().N, false, true, func(privateKey []byte) []byte {
+			x, y := curve.ScalarBaseMult(privateKey)
+			return elliptic.MarshalCompressed(curve, x, y)
+		}}, nil
+	case VersionSchnorr:
+		return &hdCurve{"Bitcoin seed", btcec.S256().N, false, false, func(privateKey []byte) []byte {
+			_, public := btcec.PrivKeyFromBytes(privateKey)
+			return public.SerializeCompressed()
+		}}, nil
+	case VersionEd25519:
+		return &hdCurve{"ed25519 seed", nil, true, false, nil}, nil
+	}
+	return nil, errUnknownScheme
+}
+
+func NewMasterKey(seed []byte, version byte) (*ExtendedKey, error) {
+	curve, err := getHDCurve(version)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := hmacSHA512([]byte(curve.seedKey), seed)
+
+	for curve.order != nil {
+		k := new(big.Int).SetBytes(sum[:32])
+		if k.Sign() != 0 && k.Cmp(curve.order) < 0 {
+			break
+		}
+		if !curve.retry {
+			return nil, errInvalidChild
+		}
+		sum = hmacSHA512([]byte(curve.seedKey), sum)
+	}
+
+	return &ExtendedKey{version, sum[:32], sum[32:], 0, 0}, nil
+}
+
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	curve, err := getHDCurve(k.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	hardened := index >= HardenedKeyStart
+	if curve.hardenedOnly && !hardened {
+		return nil, errHardenedOnly
+	}
+
+	data := []byte{}
+	if hardened {
+		data = append([]byte{0x00}, k.Key...)
+	} else {
+		data = curve.publicKey(k.Key)
+	}
+
+	var i [4]byte
+	binary.BigEndian.PutUint32(i[:], index)
+	data = append(data, i[:]...)
+
+	sum := hmacSHA512(k.ChainCode, data)
+	if curve.order == nil {
+		return &ExtendedKey{k.Version, sum[:32], sum[32:], k.Depth + 1, index}, nil
+	}
+
+	for {
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(curve.order) < 0 {
+			child := il.Add(il, new(big.Int).SetBytes(k.Key))
+			child.Mod(child, curve.order)
+			if child.Sign() != 0 {
+				return &ExtendedKey{k.Version, child.FillBytes(make([]byte, 32)), sum[32:], k.Depth + 1, index}, nil
+			}
+		}
+
+		if !curve.retry {
+			return nil, errInvalidChild
+		}
+		sum = hmacSHA512(k.ChainCode, append(append([]byte{0x01}, sum[32:]...), i[:]...))
+	}
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (k *ExtendedKey) DerivePath(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		child, err := key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+
+	return key, nil
+}
+
+// Wallet returns the wallet of the key pair at this node.
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	scheme, err := GetSignatureScheme(k.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := scheme.NewSigner(k.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Wallet{k.Key, signer.PublicKey(), nil}, nil
+}
+
+// ParseDerivationPath parses paths like m/44'/1'/0'/0/3.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, errDerivationPath
+	}
+
+	indexes := []uint32{}
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		part = strings.TrimRight(part, "'h")
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedKeyStart {
+			return nil, errDerivationPath
+		}
+
+		if hardened {
+			index += uint64(HardenedKeyStart)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+func FormatDerivationPath(path []uint32) string {
+	formatted := "m"
+	for _, index := range path {
+		if index >= HardenedKeyStart {
+			formatted += "/" + strconv.FormatUint(uint64(index-HardenedKeyStart), 10) + "'"
+		} else {
+			formatted += "/" + strconv.FormatUint(uint64(index), 10)
+		}
+	}
+
+	return formatted
+}
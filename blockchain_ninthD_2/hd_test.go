@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+import "encoding/hex"
+import "github.com/tyler-smith/go-bip39"
+
+func hdTestHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// the first test vector of BIP32 and SLIP-10, and the SLIP-10 P-256
+// vectors where a derived key is invalid and derived again
+func TestDerivePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   byte
+		seed      string
+		path      string
+		chainCode string
+		key       string
+	}{
+		{"bip32 master", VersionSchnorr, "000102030405060708090a0b0c0d0e0f", "m",
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"bip32 hardened", VersionSchnorr, "000102030405060708090a0b0c0d0e0f", "m/0'",
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"bip32 normal", VersionSchnorr, "000102030405060708090a0b0c0d0e0f", "m/0'/1",
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"p256 master", VersionP256, "000102030405060708090a0b0c0d0e0f", "m",
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{"p256 hardened", VersionP256, "000102030405060708090a0b0c0d0e0f", "m/0'",
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{"p256 retried child", VersionP256, "000102030405060708090a0b0c0d0e0f", "m/28578'/33941",
+			"9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071", "092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a"},
+		{"p256 retried master", VersionP256, "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446", "m",
+			"7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c", "3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f"},
+		{"ed25519 master", VersionEd25519, "000102030405060708090a0b0c0d0e0f", "m",
+			"90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{"ed25519 hardened", VersionEd25519, "000102030405060708090a0b0c0d0e0f", "m/0'/1'",
+			"a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14", "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2"},
+	}
+
+	for _, test := range tests {
+		master, err := NewMasterKey(hdTestHex(t, test.seed), test.version)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		path, err := ParseDerivationPath(test.path)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		key, err := master.DerivePath(path)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if got := hex.EncodeToString(key.ChainCode); got != test.chainCode {
+			t.Errorf("%s: chain code %s, want %s", test.name, got, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.Key); got != test.key {
+			t.Errorf("%s: key %s, want %s", test.name, got, test.key)
+		}
+	}
+}
+
+func TestDeriveEd25519HardenedOnly(t *testing.T) {
+	master, err := NewMasterKey(hdTestHex(t, "000102030405060708090a0b0c0d0e0f"), VersionEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := master.Child(1); err != errHardenedOnly {
+		t.Errorf("got %v, want %v", err, errHardenedOnly)
+	}
+}
+
+// the first English vector of BIP39, with its passphrase TREZOR
+func TestMnemonicSeed(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(entropy) != "00000000000000000000000000000000" {
+		t.Errorf("entropy %x", entropy)
+	}
+
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if hex.EncodeToString(seed) != want {
+		t.Errorf("seed %x, want %s", seed, want)
+	}
+
+	if _, err := NewKeychainFromMnemonic(mnemonic+" abandon", VersionSchnorr); err == nil {
+		t.Error("a mnemonic with a bad checksum was accepted")
+	}
+}
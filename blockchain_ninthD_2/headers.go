@@ -0,0 +1,331 @@
+package main
+
+import "bytes"
+import "errors"
+import "math/big"
+import "encoding/binary"
+import "github.com/boltdb/bolt"
+
+// the header tree lives next to the block bodies in its own bucket.
+// entries are hash -> header(80) | height(4), "l" is the best header.
+const headersBucket = "headers"
+
+var errUnknownParent = errors.New("header doesn't connect to a known header")
+var errBadBits = errors.New("header has unexpected difficulty bits")
+var errBadProofOfWork = errors.New("header hash doesn't meet its target")
+var errNotOnTip = errors.New("best header chain doesn't extend the local tip, reorganisations aren't supported")
+
+func encodeHeaderEntry(header BlockHeader, height uint32) []byte {
+	entry := header.Serialize()
+
+	var h [4]byte
+	binary.LittleEndian.PutUint32(h[:], height)
+
+	return append(entry, h[:]...)
+}
+
+func decodeHeaderEntry(entry []byte) (BlockHeader, uint32) {
+	return DeserializeBlockHeader(entry[:BlockHeaderSize]), binary.LittleEndian.Uint32(entry[BlockHeaderSize:])
+}
+
+// indexHeader adds header to the header tree and makes it the best header
+// when its chain is longer. The parent must already be indexed.
+func indexHeader(b *bolt.Bucket, header BlockHeader) error {
+	height := uint32(0)
+
+	if header.HasParent() {
+		parent := b.Get(header.PrevBlockHash[:])
+		if parent == nil {
+			return errUnknownParent
+		}
+		_, parentHeight := decodeHeaderEntry(parent)
+		height = parentHeight + 1
+	}
+
+	hash := header.Hash()
+	if err := b.Put(hash, encodeHeaderEntry(header, height)); err != nil {
+		return err
+	}
+
+	best := b.Get([]byte("l"))
+	if best != nil {
+		_, bestHeight := decodeHeaderEntry(b.Get(best))
+		if bestHeight >= height {
+			return nil
+		}
+	}
+
+	return b.Put([]byte("l"), hash)
+}
+
+// IndexHeaders fills the header tree from the stored blocks, for chains
+// created before headers were kept separately.
+func (bc *BlockChain) IndexHeaders() {
+	indexed := false
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		indexed = tx.Bucket([]byte(headersBucket)) != nil
+		return nil
+	})
+
+	if indexed {
+		return
+	}
+
+	headers := []BlockHeader{}
+	bci := NewBlockchainIterator(bc)
+	for {
+		block := bci.Next()
+		headers = append([]BlockHeader{block.Header}, headers...)
+
+		if len(bci.currentHash) == 0 {
+			break
+		}
+	}
+
+	_ = bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(headersBucket))
+		if err != nil {
+			return err
+		}
+
+		for _, header := range headers {
+			if err := indexHeader(b, header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HeaderStore reads and extends the header tree of a bolt database. Full
+// nodes keep it next to their blocks, light clients keep nothing else.
+type HeaderStore struct {
+	db *bolt.DB
+}
+
+func NewHeaderStore(db *bolt.DB) *HeaderStore {
+	_ = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(headersBucket))
+		return err
+	})
+
+	return &HeaderStore{db}
+}
+
+func (bc *BlockChain) Headers() *HeaderStore {
+	return &HeaderStore{bc.db}
+}
+
+func (hs *HeaderStore) GetHeader(hash []byte) (BlockHeader, uint32, bool) {
+	var header BlockHeader
+	var height uint32
+	found := false
+
+	hs.db.View(func(tx *bolt.Tx) error {
+		entry := tx.Bucket([]byte(headersBucket)).Get(hash)
+		if entry != nil {
+			header, height = decodeHeaderEntry(entry)
+			found = true
+		}
+		return nil
+	})
+
+	return header, height, found
+}
+
+// BestHeader returns the hash of the tip of the longest header chain.
+func (hs *HeaderStore) BestHeader() []byte {
+	var best []byte
+
+	hs.db.View(func(tx *bolt.Tx) error {
+		best = append(best, tx.Bucket([]byte(headersBucket)).Get([]byte("l"))...)
+		return nil
+	})
+
+	return best
+}
+
+// BestChain returns the hashes of the best header chain, genesis first.
+func (hs *HeaderStore) BestChain() [][]byte {
+	hashes := [][]byte{}
+
+	hash := hs.BestHeader()
+	for {
+		header, _, found := hs.GetHeader(hash)
+		if !found {
+			break
+		}
+		hashes = append([][]byte{hash}, hashes...)
+
+		if !header.HasParent() {
+			break
+		}
+		hash = header.PrevBlockHash[:]
+	}
+
+	return hashes
+}
+
+// InBestChain reports whether hash is an ancestor of, or is, the best header.
+func (hs *HeaderStore) InBestChain(hash []byte) bool {
+	_, height, found := hs.GetHeader(hash)
+	if !found {
+		return false
+	}
+
+	best := hs.BestHeader()
+	header, bestHeight, _ := hs.GetHeader(best)
+	for bestHeight > height {
+		best = append([]byte{}, header.PrevBlockHash[:]...)
+		header, bestHeight, _ = hs.GetHeader(best)
+	}
+
+	return bytes.Compare(best, hash) == 0
+}
+
+func (bc *BlockChain) Height() uint32 {
+	_, height, _ := bc.Headers().GetHeader(bc.tip)
+
+	return height
+}
+
+func (bc *BlockChain) HasBlock(hash []byte) bool {
+	found := false
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(blocksBucket)).Get(hash) != nil
+		return nil
+	})
+
+	return found
+}
+
+// ExpectedBits returns the difficulty bits a child of parent must carry.
+// There is no retargeting yet, every block after genesis uses TargetBits.
+func ExpectedBits(parent *BlockHeader) uint32 {
+	if parent == nil {
+		return GenesisTargetBits
+	}
+	return TargetBits
+}
+
+// CheckHeader checks a header on its own and against its parent:
+// linkage, difficulty bits and proof of work.
+func CheckHeader(header, parent *BlockHeader) error {
+	if parent == nil && header.HasParent() {
+		return errUnknownParent
+	}
+	if parent != nil && bytes.Compare(header.PrevBlockHash[:], parent.Hash()) != 0 {
+		return errUnknownParent
+	}
+
+	if header.Bits != ExpectedBits(parent) {
+		return errBadBits
+	}
+
+	target := big.NewInt(1)
+	target.Lsh(target, uint(header.Bits))
+
+	hashInt := new(big.Int).SetBytes(header.Hash())
+	if hashInt.Cmp(target) != -1 {
+		return errBadProofOfWork
+	}
+
+	return nil
+}
+
+// AddHeaders validates headers, in order, and adds them to the header
+// tree. It stops at the first invalid header.
+// A genesis header is only accepted into an empty tree.
+func (hs *HeaderStore) AddHeaders(headers []BlockHeader) error {
+	return hs.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(headersBucket))
+
+		for _, header := range headers {
+			if b.Get(header.Hash()) != nil {
+				continue
+			}
+
+			var parent *BlockHeader
+			if header.HasParent() {
+				entry := b.Get(header.PrevBlockHash[:])
+				if entry == nil {
+					return errUnknownParent
+				}
+				parentHeader, _ := decodeHeaderEntry(entry)
+				parent = &parentHeader
+			} else if b.Get([]byte("l")) != nil {
+				return errUnknownParent
+			}
+
+			if err := CheckHeader(&header, parent); err != nil {
+				return err
+			}
+
+			if err := indexHeader(b, header); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BlockLocator lists hashes of the best header chain from the tip back to
+// genesis, dense near the tip and exponentially sparser after, so a peer
+// can find where our chains fork.
+func (hs *HeaderStore) BlockLocator() [][]byte {
+	locator := [][]byte{}
+	step := 1
+	skip := 0
+
+	hash := hs.BestHeader()
+	for {
+		header, _, found := hs.GetHeader(hash)
+		if !found {
+			break
+		}
+
+		// always end with genesis
+		if !header.HasParent() {
+			locator = append(locator, hash)
+			break
+		}
+
+		if skip == 0 {
+			locator = append(locator, hash)
+			if len(locator) >= 10 {
+				step *= 2
+			}
+			skip = step
+		}
+		skip--
+
+		hash = header.PrevBlockHash[:]
+	}
+
+	return locator
+}
+
+// MissingBlocks returns, oldest first, the hashes on the best header chain
+// whose bodies haven't been downloaded yet.
+func (bc *BlockChain) MissingBlocks() ([][]byte, error) {
+	missing := [][]byte{}
+
+	hash := bc.Headers().BestHeader()
+	for !bc.HasBlock(hash) {
+		header, _, found := bc.Headers().GetHeader(hash)
+		if !found || !header.HasParent() {
+			return nil, errNotOnTip
+		}
+
+		missing = append([][]byte{hash}, missing...)
+		hash = header.PrevBlockHash[:]
+	}
+
+	if bytes.Compare(hash, bc.tip) != 0 {
+		return nil, errNotOnTip
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import "bytes"
+import "errors"
+import "encoding/gob"
+import "encoding/hex"
+import "github.com/tyler-smith/go-bip39"
+
+// BIP44 style paths: m/44'/coin'/account'/change/index. Ed25519 keychains
+// harden every level.
+const (
+	hdPurpose  uint32 = 44
+	hdCoinType uint32 = 1
+
+	ExternalChain uint32 = 0
+	ChangeChain   uint32 = 1
+
+	// addresses in a row without any history before discovery stops
+	HDGapLimit = 20
+)
+
+var errNoKeychain = errors.New("the wallet has no HD keychain, run hdinit or hdrestore first")
+var errKeychainExists = errors.New("the wallet already has an HD keychain")
+var errInvalidChainKey = errors.New("derived chain key is invalid, use another account")
+
+// Keychain derives every wallet key from one seed, so the mnemonic is the
+// whole backup. Like a wallet key, the seed is nil while it is encrypted
+// and locked.
+type Keychain struct {
+	Seed    []byte
+	Version byte
+	Account uint32
+	// next unused index of the external and change chains
+	Next          [2]uint32
+	EncryptedSeed []byte
+}
+
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+func NewKeychainFromMnemonic(mnemonic string, version byte) (*Keychain, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := NewMasterKey(seed, version); err != nil {
+		return nil, err
+	}
+
+	return &Keychain{seed, version, 0, [2]uint32{}, nil}, nil
+}
+
+func (kc *Keychain) Path(change, index uint32) []uint32 {
+	path := []uint32{hdPurpose + HardenedKeyStart, hdCoinType + HardenedKeyStart, kc.Account + HardenedKeyStart, change, index}
+
+	if curve, _ := getHDCurve(kc.Version); curve != nil && curve.hardenedOnly {
+		path[3] += HardenedKeyStart
+		path[4] += HardenedKeyStart
+	}
+
+	return path
+}
+
+// DeriveWallet returns errInvalidChild when there is no key at index, the
+// caller goes on with the next index. Any other level failing is
+// errInvalidChainKey, no index of the chain has a key then.
+func (kc *Keychain) DeriveWallet(change, index uint32) (*Wallet, error) {
+	if kc.Seed == nil {
+		return nil, errWalletLocked
+	}
+
+	master, err := NewMasterKey(kc.Seed, kc.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	path := kc.Path(change, index)
+	chainKey, err := master.DerivePath(path[:len(path)-1])
+	if err == errInvalidChild {
+		return nil, errInvalidChainKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := chainKey.Child(path[len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Wallet()
+}
+
+// Discover finds the addresses with history on the external and change
+// chains, stopping after gapLimit unused addresses in a row. It returns
+// the wallets found and moves Next past the last used index.
+func (kc *Keychain) Discover(used map[string]bool, gapLimit int) ([]*Wallet, error) {
+	found := []*Wallet{}
+
+	for _, change := range []uint32{ExternalChain, ChangeChain} {
+		gap := 0
+		next := uint32(0)
+
+		for index := uint32(0); gap < gapLimit; index++ {
+			wallet, err := kc.DeriveWallet(change, index)
+			if err == errInvalidChild {
+				// no key at this index, BIP32 moves on to the next one
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if used[hex.EncodeToString(HashPubKey(wallet.PublicKey))] {
+				found = append(found, wallet)
+				next = index + 1
+				gap = 0
+			} else {
+				gap++
+			}
+		}
+
+		kc.Next[change] = next
+	}
+
+	return found, nil
+}
+
+func (kc *Keychain) Encrypt(crypter *WalletCrypter) error {
+	encrypted, err := crypter.Seal(kc.Seed)
+	if err != nil {
+		return err
+	}
+
+	kc.EncryptedSeed = encrypted
+
+	return nil
+}
+
+func (kc *Keychain) Decrypt(crypter *WalletCrypter) error {
+	seed, err := crypter.Open(kc.EncryptedSeed)
+	if err != nil {
+		return err
+	}
+
+	kc.Seed = seed
+
+	return nil
+}
+
+func (kc *Keychain) Lock() {
+	if kc.EncryptedSeed == nil {
+		return
+	}
+
+	for i := range kc.Seed {
+		kc.Seed[i] = 0
+	}
+	kc.Seed = nil
+}
+
+func (kc *Keychain) Serialize() []byte {
+	var result bytes.Buffer
+
+	stored := *kc
+	if stored.EncryptedSeed != nil {
+		stored.Seed = nil
+	}
+
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(&stored)
+
+	return result.Bytes()
+}
+
+func DeserializeKeychain(buffer []byte) *Keychain {
+	var kc Keychain
+
+	decoder := gob.NewDecoder(bytes.NewReader(buffer))
+
+	_ = decoder.Decode(&kc)
+
+	return &kc
+}
+
+// UsedPubKeyHashes returns every pubkey hash an output of the chain pays to.
+func (bc *BlockChain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+
+	bci := NewBlockchainIterator(bc)
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				used[hex.EncodeToString(out.PubKeyHash)] = true
+			}
+		}
+
+		if len(bci.currentHash) == 0 {
+			break
+		}
+	}
+
+	return used
+}
@@ -0,0 +1,252 @@
+package main
+
+import "bytes"
+import "sort"
+import "encoding/hex"
+
+// the ledger is what the chain, and the mempool, did to the wallet. It is
+// built by scanning every block, so it always agrees with the chain.
+
+const (
+	CategoryReceive  = "receive"
+	CategoryGenerate = "generate"
+	CategorySend     = "send"
+	CategoryChange   = "change"
+)
+
+// LedgerEntry is one output a transaction paid to or from the wallet.
+// Amounts sent are negative.
+type LedgerEntry struct {
+	TxStr     string
+	OutInd    int
+	Category  string
+	Address   string
+	Amount    Amount
+	Ownership Ownership
+	// unconfirmed entries have no block, their height is -1
+	BlockHash []byte
+	Height    int
+	Time      uint32
+	// txid of the transaction that replaced this one in the mempool
+	ReplacedBy string
+}
+
+// LedgerTx sums up what one transaction did to the wallet.
+type LedgerTx struct {
+	TxStr   string
+	Entries []LedgerEntry
+	Net     Amount
+	// only known when the wallet funded every input
+	Fee       Amount
+	FeeKnown  bool
+	BlockHash []byte
+	Height    int
+	Time      uint32
+	// see bumpfee
+	ReplacedBy string
+	Replaces   []string
+}
+
+type Ledger struct {
+	Entries   []LedgerEntry
+	Txs       []*LedgerTx
+	TipHeight int
+}
+
+// Confirmations of an entry at height, 0 while it is in the mempool.
+func (l *Ledger) Confirmations(height int) int {
+	if height < 0 {
+		return 0
+	}
+	return l.TipHeight - height + 1
+}
+
+// BuildLedger scans the chain oldest block first, then the mempool. The
+// transactions replaced in the mempool come right before what replaced
+// them.
+func BuildLedger(bc *BlockChain, mempool *Mempool) *Ledger {
+	blocks := []*Block{}
+	bci := NewBlockchainIterator(bc)
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+
+		if len(bci.currentHash) == 0 {
+			break
+		}
+	}
+
+	// the iterator walks from the tip back
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+
+	ledger := &Ledger{TipHeight: len(blocks) - 1}
+
+	// every output the wallet has seen, to value the inputs spending them
+	outputs := make(map[string]TxOutput)
+
+	replacedBy := make(map[string][]*ReplacedTx)
+	for _, r := range Nfc_wallets.Replaced {
+		replacedBy[r.ReplacedBy] = append(replacedBy[r.ReplacedBy], r)
+	}
+	for _, replaced := range replacedBy {
+		sort.Slice(replaced, func(i, j int) bool {
+			return bytes.Compare(replaced[i].Tx.ID, replaced[j].Tx.ID) < 0
+		})
+	}
+
+	for height, block := range blocks {
+		for _, tx := range block.Transactions {
+			ledger.addReplaced(hex.EncodeToString(tx.ID), replacedBy, outputs)
+			ledger.addTransaction(tx, outputs, block.Hash, height, block.Header.Time, "")
+		}
+	}
+
+	if mempool != nil {
+		for _, tx := range mempool.Transactions() {
+			ledger.addReplaced(hex.EncodeToString(tx.ID), replacedBy, outputs)
+			ledger.addTransaction(tx, outputs, nil, -1, 0, "")
+		}
+	}
+
+	// replacements that left the mempool in turn
+	left := []string{}
+	for txStr := range replacedBy {
+		left = append(left, txStr)
+	}
+	sort.Strings(left)
+	for _, txStr := range left {
+		ledger.addReplaced(txStr, replacedBy, outputs)
+	}
+
+	for _, ltx := range ledger.Txs {
+		if ltx.ReplacedBy == "" {
+			continue
+		}
+		if replacement, ok := ledger.GetTransaction(ltx.ReplacedBy); ok {
+			replacement.Replaces = append(replacement.Replaces, ltx.TxStr)
+		}
+	}
+
+	return ledger
+}
+
+// addReplaced adds what txStr replaced, and what that replaced in turn.
+func (l *Ledger) addReplaced(txStr string, replacedBy map[string][]*ReplacedTx, outputs map[string]TxOutput) {
+	replaced := replacedBy[txStr]
+	delete(replacedBy, txStr)
+
+	for _, r := range replaced {
+		replacedStr := hex.EncodeToString(r.Tx.ID)
+		l.addReplaced(replacedStr, replacedBy, outputs)
+
+		// the replaced transaction may have been mined all the same
+		if _, ok := l.GetTransaction(replacedStr); !ok {
+			l.addTransaction(r.Tx, outputs, nil, -1, 0, r.ReplacedBy)
+		}
+	}
+}
+
+func (l *Ledger) addTransaction(tx *Transaction, outputs map[string]TxOutput, blockHash []byte, height int, time uint32, replacedBy string) {
+	txStr := hex.EncodeToString(tx.ID)
+
+	// what the wallet paid in, from which addresses, and whether it could
+	// sign for it
+	var debit Amount
+	funder := NotMine
+	funding := make(map[string]bool)
+	allFunded := true
+	for _, in := range tx.Vin {
+		out, ok := outputs[outpointKey(in.Txid, in.Vout)]
+		if !ok {
+			allFunded = false
+			continue
+		}
+		debit += out.Value
+		funding[hex.EncodeToString(out.PubKeyHash)] = true
+
+		if ownership := Nfc_wallets.Ownership(out.PubKeyHash); ownership == Spendable || funder == NotMine {
+			funder = ownership
+		}
+	}
+
+	ltx := &LedgerTx{TxStr: txStr, BlockHash: blockHash, Height: height, Time: time, ReplacedBy: replacedBy}
+	var credit Amount
+	var paid Amount
+
+	for outInd, out := range tx.Vout {
+		paid += out.Value
+		ownership := Nfc_wallets.Ownership(out.PubKeyHash)
+		address := NewPubKeyHashAddress(out.PubKeyHash).String()
+
+		if ownership != NotMine {
+			outputs[outpointKey(tx.ID, outInd)] = out
+			credit += out.Value
+		}
+
+		// change goes back to where the coins came from or to a change
+		// address, a payment to
+		// another address of the wallet is both a send and a receive
+		if funder != NotMine && (funding[hex.EncodeToString(out.PubKeyHash)] || Nfc_wallets.IsChange(out.PubKeyHash)) {
+			ltx.Entries = append(ltx.Entries, LedgerEntry{txStr, outInd, CategoryChange, address, out.Value, ownership, blockHash, height, time, replacedBy})
+			continue
+		}
+
+		if funder != NotMine {
+			ltx.Entries = append(ltx.Entries, LedgerEntry{txStr, outInd, CategorySend, address, -out.Value, funder, blockHash, height, time, replacedBy})
+		}
+
+		if ownership != NotMine {
+			category := CategoryReceive
+			if tx.IsCoinbase() {
+				category = CategoryGenerate
+			}
+			ltx.Entries = append(ltx.Entries, LedgerEntry{txStr, outInd, category, address, out.Value, ownership, blockHash, height, time, replacedBy})
+		}
+	}
+
+	if len(ltx.Entries) == 0 && debit == 0 {
+		return
+	}
+
+	ltx.Net = credit - debit
+	if funder != NotMine && allFunded {
+		ltx.Fee = debit - paid
+		ltx.FeeKnown = true
+	}
+
+	l.Entries = append(l.Entries, ltx.Entries...)
+	l.Txs = append(l.Txs, ltx)
+}
+
+// GetTransaction returns what the transaction txStr did to the wallet.
+func (l *Ledger) GetTransaction(txStr string) (*LedgerTx, bool) {
+	for _, ltx := range l.Txs {
+		if ltx.TxStr == txStr {
+			return ltx, true
+		}
+	}
+	return nil, false
+}
+
+// Page returns up to count entries, newest first, after skipping skip of
+// them. An address limits it to the entries of that address.
+func (l *Ledger) Page(address string, skip, count int) []LedgerEntry {
+	page := []LedgerEntry{}
+
+	for i := len(l.Entries) - 1; i >= 0 && len(page) < count; i-- {
+		entry := l.Entries[i]
+		if address != "" && entry.Address != address {
+			continue
+		}
+
+		if skip > 0 {
+			skip--
+			continue
+		}
+		page = append(page, entry)
+	}
+
+	return page
+}
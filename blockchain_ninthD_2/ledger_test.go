@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+import "bytes"
+import "encoding/hex"
+
+func TestLedgerCategories(t *testing.T) {
+	w := NewWallet()
+	Nfc_wallets.Wallets = map[string]*Wallet{w.GetAddress(): w}
+	Nfc_wallets.WatchOnly = make(map[string]*WatchedAddress)
+	defer func() { Nfc_wallets.Wallets = make(map[string]*Wallet) }()
+
+	mine := HashPubKey(w.PublicKey)
+	other := bytes.Repeat([]byte{0x11}, pubKeyHashLen)
+
+	coinbase := NewCoinbaseTx(w.GetAddress(), "")
+	receive := &Transaction{[]byte{0x01}, []TxInput{{[]byte{0xee}, 0, []byte{}, []byte{}, SequenceFinal}}, []TxOutput{{7, other}, {5, mine}}}
+	// spends the 5 received, 3 to another wallet, 1 back as change
+	send := &Transaction{[]byte{0x02}, []TxInput{{receive.ID, 1, []byte{}, w.PublicKey, SequenceFinal}}, []TxOutput{{3, other}, {1, mine}}}
+
+	ledger := &Ledger{}
+	outputs := make(map[string]TxOutput)
+	for height, tx := range []*Transaction{coinbase, receive, send} {
+		ledger.addTransaction(tx, outputs, []byte{byte(height)}, height, 0, "")
+	}
+
+	want := []struct {
+		tx       *Transaction
+		outInd   int
+		category string
+		amount   Amount
+	}{
+		{coinbase, 0, CategoryGenerate, BlockReward},
+		{receive, 1, CategoryReceive, 5},
+		{send, 0, CategorySend, -3},
+		{send, 1, CategoryChange, 1},
+	}
+	if len(ledger.Entries) != len(want) {
+		t.Fatalf("%d entries, want %d: %+v", len(ledger.Entries), len(want), ledger.Entries)
+	}
+	for i, entry := range ledger.Entries {
+		if entry.TxStr != ledgerTestTxStr(want[i].tx) || entry.OutInd != want[i].outInd || entry.Category != want[i].category || entry.Amount != want[i].amount {
+			t.Errorf("entry %d is %s %d %s %d, want %s %d %s %d", i, entry.TxStr, entry.OutInd, entry.Category, entry.Amount,
+				ledgerTestTxStr(want[i].tx), want[i].outInd, want[i].category, want[i].amount)
+		}
+	}
+
+	ltx, ok := ledger.GetTransaction(ledgerTestTxStr(send))
+	if !ok || ltx.Net != -4 || ltx.Fee != 1 || !ltx.FeeKnown {
+		t.Errorf("send: %+v, want net -4 and fee 1", ltx)
+	}
+	ltx, ok = ledger.GetTransaction(ledgerTestTxStr(receive))
+	if !ok || ltx.Net != 5 || ltx.Fee != 0 || ltx.FeeKnown {
+		t.Errorf("receive: %+v, want net 5 and no fee", ltx)
+	}
+
+	// the change plus an input of another wallet, whose value is unknown
+	joint := &Transaction{[]byte{0x03}, []TxInput{{send.ID, 1, []byte{}, w.PublicKey, SequenceFinal}, {[]byte{0xee}, 1, []byte{}, []byte{}, SequenceFinal}}, []TxOutput{{4, other}}}
+	ledger.addTransaction(joint, outputs, []byte{3}, 3, 0, "")
+	ltx, ok = ledger.GetTransaction(ledgerTestTxStr(joint))
+	if !ok || ltx.Net != -1 || ltx.Fee != 0 || ltx.FeeKnown {
+		t.Errorf("joint: %+v, want net -1 and an unknown fee", ltx)
+	}
+}
+
+func ledgerTestTxStr(tx *Transaction) string {
+	return hex.EncodeToString(tx.ID)
+}
@@ -1,28 +1,54 @@
 package main
 
-import "strconv"
+import "flag"
+import "fmt"
+import "math"
+import "os"
 
-const MaxNonce = 9999999
+const MaxNonce = math.MaxUint32
 
 const blocksBucket = "blocks"
 
-func IntToHex(n int64) []byte {
-	return []byte(strconv.FormatInt(n, 16))
-}
-
 func main() {
+	spvPeers := flag.String("spv", "", "run as a light client against these comma separated chain files")
+	networkName := flag.String("network", "mainnet", "mainnet, testnet or regtest, the network addresses are for")
+	spvFilters := flag.Bool("filters", false, "let the light client scan compact block filters instead of asking for proofs, a block is fetched when any peer's filter matches")
+	flag.Parse()
+
+	network, err := GetNetwork(*networkName)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	ActiveNetwork = network
+
 	LoadWallets()
 
-	bc := NewBlockChain("LkGGzXxTNqvqVp34mgjrbz1qxuJ7yo9svg")
-	defer bc.db.Close()
+	if *spvPeers != "" {
+		peers := OpenFilePeers(*spvPeers)
+		defer ClosePeers(peers)
+
+		lc := NewLightClient("NFC_spv", peers)
+		lc.UseFilters = *spvFilters
+		defer lc.Close()
+
+		cli := LightCLI{lc}
+		cli.Run(flag.Args())
+		return
+	}
+
+	bc := NewBlockChain()
+	defer bc.Close()
 
 	utxoset := &UTXOSet{"NFC_UTXOset", "utxoset", make(map[string][]UTXO)}
 
+	// rebuilt from the chain every time, a UTXO set file written by an
+	// older version is never read
 	utxoset.UTXOSet = bc.GetUTXOSet()
 	utxoset.PersistUTXOSet()
 	// utxoset.UTXOSet = LoadUTXOSet("NFC_UTXOset", "utxoset")
 
-	cli := CLI{bc, utxoset}
+	cli := CLI{bc, utxoset, NewMempool()}
 
-	cli.Run()
+	cli.Run(flag.Args())
 }
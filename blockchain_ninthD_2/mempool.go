@@ -0,0 +1,331 @@
+package main
+
+import "fmt"
+import "os"
+import "bytes"
+import "errors"
+import "encoding/hex"
+import "github.com/boltdb/bolt"
+
+var errMempoolConflict = errors.New("transaction spends an output already spent in the mempool")
+var errReplacementFee = errors.New("a replacement must pay a higher fee than the transactions it replaces together")
+var errTooManyReplacements = errors.New("the replacement would evict too many transactions")
+var errReplacementSpendsConflict = errors.New("a replacement can't spend outputs of the transactions it replaces")
+var errInMempool = errors.New("a transaction with this ID is already in the mempool")
+var errMempoolLocked = errors.New("the mempool is used by another process, try again later")
+var errMempoolFormat = errors.New("the mempool file was written by an older version, move it away to start an empty mempool")
+
+// kept next to the transactions, mempools written before amounts were
+// counted in base units have none
+const mempoolFormatKey = "format"
+const mempoolFormat byte = 1
+
+// checkMempoolFormat accepts an empty bucket, Add writes the format then.
+func checkMempoolFormat(b *bolt.Bucket) error {
+	format := b.Get([]byte(mempoolFormatKey))
+	if format == nil {
+		if k, _ := b.Cursor().First(); k == nil {
+			return nil
+		}
+	}
+	if !bytes.Equal(format, []byte{mempoolFormat}) {
+		return errMempoolFormat
+	}
+	return nil
+}
+
+// at most this many mempool transactions are evicted by one replacement
+const maxReplacementEvictions = 100
+
+// Mempool keeps the transactions waiting to be mined in their own bolt
+// file, so a send can queue a transaction for a miner running later.
+type Mempool struct {
+	dbFile     string
+	bucketName string
+}
+
+func NewMempool() *Mempool {
+	return &Mempool{"NFC_mempool", "mempool"}
+}
+
+// open waits for another process holding the mempool file as openChain
+// does for the chain file.
+func (mp *Mempool) open() (*bolt.DB, error) {
+	db, err := bolt.Open(mp.dbFile, 0600, &bolt.Options{Timeout: chainLockTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, errMempoolLocked
+	}
+	return db, err
+}
+
+// Add queues transaction. When it spends an output a mempool transaction
+// already spends, it replaces that transaction and its descendants, if
+// they signal replace-by-fee and it pays a higher fee than they do
+// together, see BIP 125. Add returns the transactions replaced. A
+// transaction whose ID is already in the mempool or the chain is refused,
+// its outputs would be mixed up with the other one's.
+func (mp *Mempool) Add(transaction *Transaction, bc *BlockChain) ([]*Transaction, error) {
+	if err := bc.CheckNewTransactions([]*Transaction{transaction}); err != nil {
+		return nil, err
+	}
+
+	db, err := mp.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pending, err := mp.readTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []*Transaction{}
+	for _, tx := range pending {
+		if bytes.Compare(tx.ID, transaction.ID) == 0 {
+			return nil, errInMempool
+		}
+		if spendsSameOutput(tx, transaction) {
+			conflicts = append(conflicts, tx)
+		}
+	}
+
+	replaced := []*Transaction{}
+	if len(conflicts) > 0 {
+		var err error
+		replaced, err = checkReplacement(transaction, conflicts, pending, bc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(mp.bucketName))
+		if err != nil {
+			return err
+		}
+
+		if err := checkMempoolFormat(b); err != nil {
+			return err
+		}
+		if err := b.Put([]byte(mempoolFormatKey), []byte{mempoolFormat}); err != nil {
+			return err
+		}
+
+		for _, old := range replaced {
+			if err := b.Delete(old.ID); err != nil {
+				return err
+			}
+		}
+
+		return b.Put(transaction.ID, transaction.Serialize())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replaced, nil
+}
+
+func spendsSameOutput(a, b *Transaction) bool {
+	for _, aIn := range a.Vin {
+		for _, bIn := range b.Vin {
+			if bytes.Compare(aIn.Txid, bIn.Txid) == 0 && aIn.Vout == bIn.Vout {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkReplacement applies the replace-by-fee rules and returns what tx
+// evicts: conflicts and every pending transaction spending their outputs.
+func checkReplacement(tx *Transaction, conflicts, pending []*Transaction, bc *BlockChain) ([]*Transaction, error) {
+	for _, conflict := range conflicts {
+		if !conflict.SignalsReplacement() {
+			return nil, errMempoolConflict
+		}
+	}
+
+	replaced := descendants(conflicts, pending)
+	if len(replaced) > maxReplacementEvictions {
+		return nil, errTooManyReplacements
+	}
+
+	evicted := make(map[string]bool)
+	for _, old := range replaced {
+		evicted[hex.EncodeToString(old.ID)] = true
+	}
+	for _, in := range tx.Vin {
+		if evicted[hex.EncodeToString(in.Txid)] {
+			return nil, errReplacementSpendsConflict
+		}
+	}
+
+	prevOuts := bc.FindPreviousOutputs(append([]*Transaction{tx}, pending...))
+
+	fee, err := TxFee(tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+
+	var replacedFees Amount
+	for _, old := range replaced {
+		oldFee, err := TxFee(old, prevOuts)
+		if err != nil {
+			return nil, err
+		}
+		if replacedFees, err = replacedFees.Add(oldFee); err != nil {
+			return nil, err
+		}
+	}
+
+	if fee <= replacedFees {
+		return nil, errReplacementFee
+	}
+
+	return replaced, nil
+}
+
+// descendants returns txs and the pending transactions spending their
+// outputs, directly or through other pending transactions.
+func descendants(txs, pending []*Transaction) []*Transaction {
+	found := append([]*Transaction{}, txs...)
+	seen := make(map[string]bool)
+	for _, tx := range txs {
+		seen[hex.EncodeToString(tx.ID)] = true
+	}
+
+	for i := 0; i < len(found); i++ {
+		for _, tx := range pending {
+			if seen[hex.EncodeToString(tx.ID)] {
+				continue
+			}
+			for _, in := range tx.Vin {
+				if bytes.Compare(in.Txid, found[i].ID) == 0 {
+					seen[hex.EncodeToString(tx.ID)] = true
+					found = append(found, tx)
+					break
+				}
+			}
+		}
+	}
+
+	return found
+}
+
+// TxFee is what the inputs of tx are worth above its outputs, prevOuts
+// holds the outputs spent, as FindPreviousOutputs returns them.
+// The fee is negative when the outputs are worth more.
+func TxFee(tx *Transaction, prevOuts map[string]TxOutput) (Amount, error) {
+	var in, out Amount
+	for _, txin := range tx.Vin {
+		prevOut, ok := prevOuts[outpointKey(txin.Txid, txin.Vout)]
+		if !ok {
+			return 0, errMissingPrevOutput
+		}
+
+		var err error
+		if in, err = in.Add(prevOut.Value); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, txout := range tx.Vout {
+		var err error
+		if out, err = out.Add(txout.Value); err != nil {
+			return 0, err
+		}
+	}
+
+	return in - out, nil
+}
+
+// Fee is what tx pays, it may spend outputs of mempool transactions.
+func (mp *Mempool) Fee(tx *Transaction, bc *BlockChain) (Amount, error) {
+	return TxFee(tx, bc.FindPreviousOutputs(append([]*Transaction{tx}, mp.Transactions()...)))
+}
+
+func (mp *Mempool) Transactions() []*Transaction {
+	db, err := mp.open()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	txs, err := mp.readTransactions(db)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	return txs
+}
+
+func (mp *Mempool) readTransactions(db *bolt.DB) ([]*Transaction, error) {
+	txs := []*Transaction{}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(mp.bucketName))
+
+		if b == nil {
+			return nil
+		}
+
+		if err := checkMempoolFormat(b); err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == mempoolFormatKey {
+				return nil
+			}
+			txs = append(txs, DeserializeTransaction(v))
+			return nil
+		})
+	})
+
+	return txs, err
+}
+
+func (mp *Mempool) Remove(txs []*Transaction) {
+	db, err := mp.open()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(mp.bucketName))
+
+		if b == nil {
+			return nil
+		}
+
+		for _, transaction := range txs {
+			if err := b.Delete(transaction.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+}
+
+// Fingerprint identifies the current mempool content, the miner restarts
+// its block whenever it changes.
+func (mp *Mempool) Fingerprint() string {
+	fingerprint := ""
+
+	for _, tx := range mp.Transactions() {
+		fingerprint += hex.EncodeToString(tx.ID)
+	}
+
+	return fingerprint
+}
@@ -0,0 +1,134 @@
+package main
+
+import "testing"
+import "bytes"
+import "os"
+
+var mempoolTestPubKeyHash = bytes.Repeat([]byte{0x11}, pubKeyHashLen)
+
+// mempoolTestChain starts a chain in a fresh directory with a block
+// holding one transaction of outputs worth values, for the mempool
+// transactions to spend.
+func mempoolTestChain(t *testing.T, pubKeyHash []byte, values ...Amount) (*BlockChain, *Mempool, *Transaction) {
+	t.Chdir(t.TempDir())
+
+	bc := NewBlockChain()
+	t.Cleanup(func() { bc.db.Close() })
+
+	funding := &Transaction{[]byte{}, []TxInput{}, []TxOutput{}}
+	for _, value := range values {
+		funding.Vout = append(funding.Vout, TxOutput{value, pubKeyHash})
+	}
+	funding.SetID()
+	bc.AddBlock([]*Transaction{funding})
+
+	return bc, NewMempool(), funding
+}
+
+// spendTestTx spends vout of prev, paying the values.
+func spendTestTx(prev *Transaction, vout int, sequence uint32, values ...Amount) *Transaction {
+	tx := &Transaction{[]byte{}, []TxInput{{prev.ID, vout, []byte{}, []byte{}, sequence}}, []TxOutput{}}
+	for _, value := range values {
+		tx.Vout = append(tx.Vout, TxOutput{value, mempoolTestPubKeyHash})
+	}
+	tx.SetID()
+	return tx
+}
+
+func mustAdd(t *testing.T, mp *Mempool, tx *Transaction, bc *BlockChain) []*Transaction {
+	replaced, err := mp.Add(tx, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replaced
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10)
+
+	original := spendTestTx(funding, 0, MaxRBFSequence, 9)
+	child := spendTestTx(original, 0, SequenceFinal, 7)
+	mustAdd(t, mp, original, bc)
+	mustAdd(t, mp, child, bc)
+
+	// the replacement has to pay more than the 1 and 2 of both together
+	for _, value := range []Amount{9, 7} {
+		if _, err := mp.Add(spendTestTx(funding, 0, SequenceFinal, value), bc); err != errReplacementFee {
+			t.Errorf("fee %d: got %v, want %v", 10-value, err, errReplacementFee)
+		}
+	}
+
+	replacement := spendTestTx(funding, 0, SequenceFinal, 6)
+	if replaced := mustAdd(t, mp, replacement, bc); len(replaced) != 2 {
+		t.Fatalf("replaced %d transactions, want the original and its child", len(replaced))
+	}
+
+	pending := mp.Transactions()
+	if len(pending) != 1 || !bytes.Equal(pending[0].ID, replacement.ID) {
+		t.Errorf("mempool holds %d transactions, want the replacement only", len(pending))
+	}
+}
+
+func TestMempoolConflictNotSignalling(t *testing.T) {
+	bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10)
+
+	mustAdd(t, mp, spendTestTx(funding, 0, SequenceFinal, 9), bc)
+
+	if _, err := mp.Add(spendTestTx(funding, 0, MaxRBFSequence, 1), bc); err != errMempoolConflict {
+		t.Errorf("got %v, want %v", err, errMempoolConflict)
+	}
+}
+
+func TestMempoolReplacementSpendsConflict(t *testing.T) {
+	bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10, 10)
+
+	original := spendTestTx(funding, 0, MaxRBFSequence, 5, 4)
+	mustAdd(t, mp, original, bc)
+
+	// spends the other funding output and an output of what it evicts
+	replacement := &Transaction{[]byte{}, []TxInput{
+		{funding.ID, 0, []byte{}, []byte{}, SequenceFinal},
+		{original.ID, 1, []byte{}, []byte{}, SequenceFinal},
+	}, []TxOutput{{1, mempoolTestPubKeyHash}}}
+	replacement.SetID()
+
+	if _, err := mp.Add(replacement, bc); err != errReplacementSpendsConflict {
+		t.Errorf("got %v, want %v", err, errReplacementSpendsConflict)
+	}
+}
+
+func TestMempoolTooManyReplacements(t *testing.T) {
+	for _, children := range []int{maxReplacementEvictions - 1, maxReplacementEvictions} {
+		bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 1000)
+
+		values := []Amount{}
+		for i := 0; i < children; i++ {
+			values = append(values, 9)
+		}
+		original := spendTestTx(funding, 0, MaxRBFSequence, values...)
+		mustAdd(t, mp, original, bc)
+		for i := 0; i < children; i++ {
+			mustAdd(t, mp, spendTestTx(original, i, SequenceFinal, 8), bc)
+		}
+
+		_, err := mp.Add(spendTestTx(funding, 0, SequenceFinal, 1), bc)
+		if evicted := children + 1; evicted > maxReplacementEvictions && err != errTooManyReplacements {
+			t.Errorf("evicting %d: got %v, want %v", evicted, err, errTooManyReplacements)
+		} else if evicted <= maxReplacementEvictions && err != nil {
+			t.Errorf("evicting %d: %v", evicted, err)
+		}
+	}
+}
+
+func TestMempoolAddFileError(t *testing.T) {
+	bc, mp, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10)
+
+	// a directory in place of the mempool file can't be opened
+	if err := os.Mkdir(mp.dbFile, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mp.Add(spendTestTx(funding, 0, SequenceFinal, 9), bc); err == nil {
+		t.Error("added without a mempool file")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import "crypto/sha256"
+
+// MerkleRoot returns the root of the merkle tree over the transaction
+// hashes. Like bitcoin, an odd node at any level is paired with itself.
+func MerkleRoot(transactions []*Transaction) []byte {
+	if len(transactions) == 0 {
+		return make([]byte, 32)
+	}
+
+	level := merkleLeaves(transactions)
+
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+
+	return level[0]
+}
+
+// MerkleProof is the branch from one transaction up to the merkle root.
+// Bit i of Index tells whether the node at level i is a right child.
+type MerkleProof struct {
+	Index  uint32
+	Branch [][]byte
+}
+
+func NewMerkleProof(transactions []*Transaction, index int) MerkleProof {
+	proof := MerkleProof{Index: uint32(index)}
+
+	level := merkleLeaves(transactions)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+
+		proof.Branch = append(proof.Branch, level[index^1])
+
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+
+	return proof
+}
+
+// Root returns the merkle root the proof leads to from leaf.
+func (proof *MerkleProof) Root(leaf []byte) []byte {
+	node := leaf
+	index := proof.Index
+
+	for _, sibling := range proof.Branch {
+		if index&1 == 1 {
+			node = hashMerkleNode(sibling, node)
+		} else {
+			node = hashMerkleNode(node, sibling)
+		}
+		index >>= 1
+	}
+
+	return node
+}
+
+func merkleLeaves(transactions []*Transaction) [][]byte {
+	leaves := [][]byte{}
+	for _, tx := range transactions {
+		leaves = append(leaves, tx.Hash())
+	}
+
+	return leaves
+}
+
+func nextMerkleLevel(level [][]byte) [][]byte {
+	if len(level)%2 == 1 {
+		level = append(level, level[len(level)-1])
+	}
+
+	next := [][]byte{}
+	for i := 0; i < len(level); i += 2 {
+		next = append(next, hashMerkleNode(level[i], level[i+1]))
+	}
+
+	return next
+}
+
+func hashMerkleNode(left, right []byte) []byte {
+	first := sha256.Sum256(append(append([]byte{}, left...), right...))
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
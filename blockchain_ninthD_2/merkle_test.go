@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+import "bytes"
+
+func merkleTestTxs(n int) []*Transaction {
+	txs := []*Transaction{}
+	for i := 0; i < n; i++ {
+		txs = append(txs, &Transaction{[]byte{byte(i)}, []TxInput{}, []TxOutput{{Amount(i + 1), []byte{byte(i)}}}})
+	}
+	return txs
+}
+
+func TestMerkleRoot(t *testing.T) {
+	txs := merkleTestTxs(5)
+	h := merkleLeaves(txs)
+
+	// the odd node of a level is paired with itself
+	h01 := hashMerkleNode(h[0], h[1])
+	h23 := hashMerkleNode(h[2], h[3])
+	h44 := hashMerkleNode(h[4], h[4])
+	h0123 := hashMerkleNode(h01, h23)
+	h4444 := hashMerkleNode(h44, h44)
+
+	tests := []struct {
+		n    int
+		root []byte
+	}{
+		{0, make([]byte, 32)},
+		{1, h[0]},
+		{2, h01},
+		{3, hashMerkleNode(h01, hashMerkleNode(h[2], h[2]))},
+		{4, h0123},
+		{5, hashMerkleNode(h0123, h4444)},
+	}
+
+	for _, test := range tests {
+		if root := MerkleRoot(txs[:test.n]); !bytes.Equal(root, test.root) {
+			t.Errorf("%d transactions: root %x, want %x", test.n, root, test.root)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 6, 7, 11} {
+		txs := merkleTestTxs(n)
+		root := MerkleRoot(txs)
+
+		for i, tx := range txs {
+			proof := NewMerkleProof(txs, i)
+			if got := proof.Root(tx.Hash()); !bytes.Equal(got, root) {
+				t.Errorf("%d transactions, leaf %d: proof leads to %x, want %x", n, i, got, root)
+			}
+
+			if n == 1 {
+				continue
+			}
+			if bytes.Equal(proof.Root(txs[(i+1)%n].Hash()), root) {
+				t.Errorf("%d transactions, leaf %d: proof holds for another leaf", n, i)
+			}
+			// the last leaf of an odd count is its own sibling
+			proof.Index ^= 1
+			if bytes.Equal(proof.Root(tx.Hash()), root) && !(i == n-1 && n%2 == 1) {
+				t.Errorf("%d transactions, leaf %d: proof holds with a wrong index", n, i)
+			}
+		}
+	}
+}
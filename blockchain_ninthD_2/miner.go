@@ -0,0 +1,197 @@
+package main
+
+import "fmt"
+import "time"
+import "bytes"
+import "context"
+import "encoding/hex"
+import "github.com/boltdb/bolt"
+
+// how often the daemon checks for a new tip or new mempool transactions
+const minerPollInterval = time.Second
+
+// how long the miner leaves the chain file to other processes between
+// blocks, more than the 50ms bolt waits between two tries to lock it
+const minerYieldInterval = 100 * time.Millisecond
+
+type Miner struct {
+	bc         *BlockChain
+	utxoset    *UTXOSet
+	mempool    *Mempool
+	rewardAddr string
+	// called by Run for every block mined, with the hashes per second
+	OnBlock func(block *Block, hashrate float64)
+}
+
+func NewMiner(bc *BlockChain, utxoset *UTXOSet, mempool *Mempool, rewardAddr string) *Miner {
+	return &Miner{bc, utxoset, mempool, rewardAddr, nil}
+}
+
+// BlockTemplate returns the transactions of the next block: a coinbase
+// paying the miner the reward and the fees, then the mempool transactions
+// selectPackages picks within the consensus limits. Invalid transactions
+// are dropped from the mempool.
+func (m *Miner) BlockTemplate() []*Transaction {
+	coinbase := NewCoinbaseTx(m.rewardAddr, "")
+
+	entries, invalid := m.templateEntries()
+	if len(invalid) > 0 {
+		m.mempool.Remove(invalid)
+	}
+
+	txs := []*Transaction{coinbase}
+	room := MaxBlockSize - blockSize([]*Transaction{coinbase})
+	for _, entry := range selectPackages(entries, MaxBlockTransactions-1, room, MaxBlockSigOps) {
+		txs = append(txs, entry.tx)
+		coinbase.Vout[0].Value += entry.fee
+	}
+
+	return txs
+}
+
+// MineBlock mines one block on the current tip and returns it with the
+// hashes per second. It returns ctx.Err() if ctx is cancelled before a
+// block is found.
+func (m *Miner) MineBlock(ctx context.Context) (*Block, float64, error) {
+	txs := m.BlockTemplate()
+
+	block, hashrate, err := m.bc.AddBlockContext(ctx, txs)
+	if err == errChainMoved {
+		m.utxoset.UTXOSet = m.bc.GetUTXOSet()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	m.utxoset.Update(block)
+	m.utxoset.PersistUTXOSet()
+	m.mempool.Remove(txs[1:])
+
+	return block, hashrate, nil
+}
+
+// Run mines blocks until ctx is done, or until maxBlocks blocks have been
+// mined when maxBlocks > 0. The block being mined is abandoned and started
+// again whenever the tip or the mempool changes. The chain file is only
+// locked between blocks, other processes can use it while mining.
+func (m *Miner) Run(ctx context.Context, maxBlocks int) int {
+	mined := 0
+
+	for maxBlocks <= 0 || mined < maxBlocks {
+		if ctx.Err() != nil {
+			break
+		}
+
+		blockCtx, cancel := context.WithCancel(ctx)
+		go m.watch(blockCtx, cancel, m.bc.tip, m.mempool.Fingerprint())
+
+		block, hashrate, err := m.MineBlock(blockCtx)
+		cancel()
+
+		if err == nil {
+			mined++
+			if m.OnBlock != nil {
+				m.OnBlock(block, hashrate)
+			}
+		} else if err == context.Canceled || err == errChainMoved {
+			if ctx.Err() == nil {
+				fmt.Println("new tip or transactions, restarting the block.")
+			}
+		} else {
+			fmt.Println("Error is ", err)
+			break
+		}
+
+		if err := m.yield(); err != nil {
+			fmt.Println("Error is ", err)
+			break
+		}
+	}
+
+	return mined
+}
+
+// yield closes the chain file for minerYieldInterval, so processes waiting
+// for it get their turn, and catches up with the blocks they added.
+func (m *Miner) yield() error {
+	tip := m.bc.tip
+	m.bc.Close()
+
+	time.Sleep(minerYieldInterval)
+
+	if err := m.bc.Reopen(); err != nil {
+		return err
+	}
+	if !bytes.Equal(m.bc.tip, tip) {
+		m.utxoset.UTXOSet = m.bc.GetUTXOSet()
+	}
+	return nil
+}
+
+func (m *Miner) watch(ctx context.Context, restart context.CancelFunc, tip []byte, fingerprint string) {
+	ticker := time.NewTicker(minerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			newTip, err := ReadChainTip()
+			if err != nil {
+				continue
+			}
+			if bytes.Compare(newTip, tip) != 0 || m.mempool.Fingerprint() != fingerprint {
+				restart()
+				return
+			}
+		}
+	}
+}
+
+// ReadChainTip opens the chain file read only for the tip stored in it, it
+// doesn't use the BlockChain a miner closes and reopens.
+func ReadChainTip() ([]byte, error) {
+	db, err := openChain(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return (&BlockChain{nil, db}).ReadTip(), nil
+}
+
+// ReadTip returns the tip stored in the database, which can be ahead of
+// bc.tip if another writer extended the chain.
+func (bc *BlockChain) ReadTip() []byte {
+	var tip []byte
+
+	bc.db.View(func(tx *bolt.Tx) error {
+		tip = append(tip, tx.Bucket([]byte(blocksBucket)).Get([]byte("l"))...)
+		return nil
+	})
+
+	return tip
+}
+
+// HasInputs reports whether every output spent by tx is still unspent.
+func (utxoset *UTXOSet) HasInputs(tx *Transaction) bool {
+	for _, in := range tx.Vin {
+		if !utxoset.HasInput(in) {
+			return false
+		}
+	}
+	return true
+}
+
+func (utxoset *UTXOSet) HasInput(in TxInput) bool {
+	pubKeyHashStr := hex.EncodeToString(HashPubKey(in.PublicKey))
+	txstr := hex.EncodeToString(in.Txid)
+
+	for _, utxo := range utxoset.UTXOSet[pubKeyHashStr] {
+		if utxo.TxStr == txstr && utxo.OutInd == in.Vout {
+			return true
+		}
+	}
+	return false
+}
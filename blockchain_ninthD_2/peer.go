@@ -0,0 +1,263 @@
+package main
+
+import "bytes"
+import "errors"
+import "os"
+import "fmt"
+import "strings"
+import "time"
+import "path/filepath"
+import "github.com/boltdb/bolt"
+
+var errNoCommonBlock = errors.New("peer shares no block with the locator, is it on another genesis?")
+var errBlockNotFound = errors.New("peer doesn't have the block")
+
+// Peer is another node we can download the chain from.
+type Peer interface {
+	Name() string
+	// GetHeaders returns up to max headers of the peer's best chain that
+	// follow the first locator hash the peer knows, or from genesis for an
+	// empty locator.
+	GetHeaders(locator [][]byte, max int) ([]BlockHeader, error)
+	GetBlock(hash []byte) (*Block, error)
+	// GetTxProofs returns every transaction of the best chain that pays to
+	// or spends from one of pubKeyHashes, with its merkle proof.
+	GetTxProofs(pubKeyHashes [][]byte) ([]TxProof, error)
+	// GetFilter returns the serialized compact filter of a block.
+	GetFilter(hash []byte) ([]byte, error)
+	// SendTransaction hands tx to the peer's mempool.
+	SendTransaction(tx *Transaction) error
+	Close()
+}
+
+// TxProof shows that Tx is in the block with hash BlockHash.
+type TxProof struct {
+	BlockHash []byte
+	Tx        *Transaction
+	Proof     MerkleProof
+}
+
+// FilePeer serves the chain stored in another node's bolt file. It stands
+// in for a network peer until nodes talk to each other.
+type FilePeer struct {
+	path string
+	db   *bolt.DB
+}
+
+// OpenFilePeers opens the comma separated chain files as peers, it exits
+// if none can be opened.
+func OpenFilePeers(peerFiles string) []Peer {
+	peers := []Peer{}
+
+	for _, path := range strings.Split(peerFiles, ",") {
+		peer, err := NewFilePeer(path)
+		if err != nil {
+			fmt.Printf("can't open peer %s: %s\n", path, err)
+			continue
+		}
+
+		peers = append(peers, peer)
+	}
+
+	if len(peers) == 0 {
+		fmt.Println("no peer to sync from.")
+		os.Exit(1)
+	}
+
+	return peers
+}
+
+func ClosePeers(peers []Peer) {
+	for _, peer := range peers {
+		peer.Close()
+	}
+}
+
+func NewFilePeer(path string) (*FilePeer, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return nil
+		}
+		return checkChainFormat(b)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &FilePeer{path, db}, nil
+}
+
+func (p *FilePeer) Name() string {
+	return p.path
+}
+
+func (p *FilePeer) Close() {
+	p.db.Close()
+}
+
+// bestChain returns the hashes and headers of the peer's chain, genesis first.
+func (p *FilePeer) bestChain() ([][]byte, []BlockHeader) {
+	hashes := [][]byte{}
+	headers := []BlockHeader{}
+
+	p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return nil
+		}
+
+		hash := b.Get([]byte("l"))
+		for len(hash) > 0 {
+			block := DeSerializeBlock(b.Get(hash))
+
+			hashes = append([][]byte{append([]byte{}, hash...)}, hashes...)
+			headers = append([]BlockHeader{block.Header}, headers...)
+
+			if !block.Header.HasParent() {
+				break
+			}
+			hash = block.Header.PrevBlockHash[:]
+		}
+		return nil
+	})
+
+	return hashes, headers
+}
+
+func (p *FilePeer) GetHeaders(locator [][]byte, max int) ([]BlockHeader, error) {
+	hashes, headers := p.bestChain()
+
+	// an empty locator asks for the chain from genesis
+	if len(locator) == 0 {
+		if max > len(headers) {
+			max = len(headers)
+		}
+		return headers[:max], nil
+	}
+
+	for _, locatorHash := range locator {
+		for height, hash := range hashes {
+			if bytes.Compare(hash, locatorHash) != 0 {
+				continue
+			}
+
+			end := height + 1 + max
+			if end > len(headers) {
+				end = len(headers)
+			}
+			return headers[height+1 : end], nil
+		}
+	}
+
+	return nil, errNoCommonBlock
+}
+
+func (p *FilePeer) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	p.db.View(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket([]byte(blocksBucket)).Get(hash)
+		if encoded != nil {
+			block = DeSerializeBlock(encoded)
+		}
+		return nil
+	})
+
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	return block, nil
+}
+
+func (p *FilePeer) GetTxProofs(pubKeyHashes [][]byte) ([]TxProof, error) {
+	proofs := []TxProof{}
+
+	touches := func(tx *Transaction) bool {
+		for _, pubKeyHash := range pubKeyHashes {
+			for _, out := range tx.Vout {
+				if bytes.Compare(out.PubKeyHash, pubKeyHash) == 0 {
+					return true
+				}
+			}
+			for _, in := range tx.Vin {
+				if bytes.Compare(HashPubKey(in.PublicKey), pubKeyHash) == 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	hashes, _ := p.bestChain()
+	for _, hash := range hashes {
+		block, err := p.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		for txInd, tx := range block.Transactions {
+			if touches(tx) {
+				proofs = append(proofs, TxProof{hash, tx, NewMerkleProof(block.Transactions, txInd)})
+			}
+		}
+	}
+
+	return proofs, nil
+}
+
+// GetFilter serves the stored filter, or builds it for chains written
+// before filters were kept.
+func (p *FilePeer) GetFilter(hash []byte) ([]byte, error) {
+	var data []byte
+
+	p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(filtersBucket))
+		if b != nil {
+			data = append(data, b.Get(hash)...)
+		}
+		return nil
+	})
+
+	if data != nil {
+		return data, nil
+	}
+
+	block, err := p.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := BuildBlockFilter(block)
+	if err != nil {
+		return nil, err
+	}
+	return filter.NBytes()
+}
+
+// SendTransaction adds tx to the mempool file next to the peer's chain.
+func (p *FilePeer) SendTransaction(tx *Transaction) error {
+	mempool := &Mempool{filepath.Join(filepath.Dir(p.path), "NFC_mempool"), "mempool"}
+
+	var tip []byte
+	p.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(blocksBucket)); b != nil {
+			tip = append(tip, b.Get([]byte("l"))...)
+		}
+		return nil
+	})
+
+	// the peer's chain prices replacements
+	_, err := mempool.Add(tx, &BlockChain{tip, p.db})
+	return err
+}
@@ -1,55 +1,156 @@
 package main
 
-import "bytes"
+import "context"
 import "crypto/sha256"
+import "encoding/binary"
 import "math/big"
+import "runtime"
+import "sync"
+import "sync/atomic"
+import "time"
 
 type ProofOfWork struct {
-	block  *Block
-	target *big.Int
+	block   *Block
+	target  *big.Int
+	Workers int
+
+	hashes  uint64
+	elapsed time.Duration
 }
 
 func NewProofOfWork(block *Block) *ProofOfWork {
 	target := big.NewInt(1)
 
-	target.Lsh(target, block.Targetbits)
+	target.Lsh(target, uint(block.Header.Bits))
 
-	pow := &ProofOfWork{block, target}
+	pow := &ProofOfWork{block: block, target: target, Workers: runtime.GOMAXPROCS(0)}
 
 	return pow
 }
 
-func (pow *ProofOfWork) PrepareData(nonce int) []byte {
-	data := bytes.Join([][]byte{pow.block.PreBlockHash, pow.block.HashTransaction(), IntToHex(int64(pow.block.Timestamp)), IntToHex(int64(pow.block.Targetbits)), IntToHex(int64(nonce))}, []byte{})
+// PrepareData returns the serialized header with the given nonce.
+func (pow *ProofOfWork) PrepareData(nonce uint32) []byte {
+	header := pow.block.Header
+	header.Nonce = nonce
 
-	return data
+	return header.Serialize()
 }
 
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var hashInt big.Int
-	var hash [32]byte
-	nonce := 1
+func (pow *ProofOfWork) Run() (uint32, []byte) {
+	nonce, hash, _ := pow.RunContext(context.Background())
+
+	return nonce, hash
+}
+
+// RunContext searches the nonce space on pow.Workers goroutines. Worker i
+// tries nonces i+1, i+1+Workers, ... When the whole space is used up the
+// header time is rolled forward and the search starts over.
+// It returns ctx.Err() if ctx is cancelled first, e.g. on a new tip.
+func (pow *ProofOfWork) RunContext(ctx context.Context) (uint32, []byte, error) {
+	start := time.Now()
+	defer func() {
+		pow.elapsed += time.Since(start)
+	}()
+
+	workers := pow.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	for {
+		// everything but the nonce stays the same until the time is rolled
+		header := pow.block.Header.Serialize()
+
+		found := make(chan uint32, workers)
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(first uint64) {
+				defer wg.Done()
+				pow.search(ctx, done, found, header, first, uint64(workers))
+			}(uint64(w + 1))
+		}
+
+		go func() {
+			wg.Wait()
+			close(found)
+		}()
+
+		nonce, ok := <-found
+		close(done)
+		wg.Wait()
+
+		if ok {
+			return nonce, pow.hashWithNonce(header, nonce), nil
+		}
+
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+
+		pow.block.Header.Time++
+	}
+}
 
-	for nonce < MaxNonce {
-		data := pow.PrepareData(nonce)
+func (pow *ProofOfWork) search(ctx context.Context, done chan struct{}, found chan uint32, header []byte, first, step uint64) {
+	var hashInt big.Int
+	var hashes uint64
+
+	data := make([]byte, len(header))
+	copy(data, header)
+
+	defer func() {
+		atomic.AddUint64(&pow.hashes, hashes)
+	}()
+
+	for nonce := first; nonce < MaxNonce; nonce += step {
+		// check for cancellation every few thousand hashes
+		if hashes%4096 == 0 {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
 
+		binary.LittleEndian.PutUint32(data[headerNonceOffset:], uint32(nonce))
 		hash := sha256.Sum256(data)
-		hashInt.SetBytes(hash[:])
+		hashes++
 
+		hashInt.SetBytes(hash[:])
 		if pow.target.Cmp(&hashInt) == 1 {
-			return nonce, hash[:]
-		} else {
-			nonce++
+			found <- uint32(nonce)
+			return
 		}
 	}
+}
+
+func (pow *ProofOfWork) hashWithNonce(header []byte, nonce uint32) []byte {
+	data := make([]byte, len(header))
+	copy(data, header)
+	binary.LittleEndian.PutUint32(data[headerNonceOffset:], nonce)
+
+	hash := sha256.Sum256(data)
 
-	return nonce, hash[:]
+	return hash[:]
+}
+
+// Hashrate returns the hashes per second of all the Run calls so far.
+func (pow *ProofOfWork) Hashrate() float64 {
+	if pow.elapsed <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&pow.hashes)) / pow.elapsed.Seconds()
 }
 
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
-	data := pow.PrepareData(pow.block.Nonce)
+	data := pow.PrepareData(pow.block.Header.Nonce)
 
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
@@ -0,0 +1,268 @@
+package main
+
+import "bytes"
+import "errors"
+import "encoding/base64"
+import "encoding/gob"
+import "encoding/hex"
+import "encoding/json"
+
+// a partially signed transaction carries, next to the unsigned
+// transaction, the output every input spends. A signer needs nothing else,
+// no chain and no other key, so each party, or an offline device, signs
+// its own inputs; the copies are then combined, finalized and extracted.
+
+// every encoded container starts with psbtMagic, so a raw transaction
+// isn't taken for one
+var psbtMagic = []byte("nfcpsbt\xff")
+
+var errBadPSBT = errors.New("not a base64 encoded partially signed transaction")
+var errPSBTMismatch = errors.New("the partially signed transactions are for different transactions")
+var errPSBTNotFinal = errors.New("the transaction isn't finalized, some inputs aren't signed")
+
+type PartialSig struct {
+	PublicKey []byte
+	Signature []byte
+}
+
+type PSBTInput struct {
+	PrevOut     TxOutput
+	SigHashType byte
+	Partial     *PartialSig
+	// set by Finalize once the partial signature verifies
+	FinalPublicKey []byte
+	FinalSignature []byte
+}
+
+func (in *PSBTInput) IsFinal() bool {
+	return len(in.FinalSignature) > 0
+}
+
+type PSBT struct {
+	Tx     *Transaction
+	Inputs []PSBTInput
+}
+
+// NewPSBT wraps tx, stripped of any signature. prevOuts[i] is the output
+// tx.Vin[i] spends and every input is to be signed with hashType.
+func NewPSBT(tx *Transaction, prevOuts []TxOutput, hashType byte) (*PSBT, error) {
+	if len(prevOuts) != len(tx.Vin) {
+		return nil, errPrevOutputs
+	}
+
+	unsigned := &Transaction{tx.ID, []TxInput{}, append([]TxOutput{}, tx.Vout...)}
+	for _, in := range tx.Vin {
+		unsigned.Vin = append(unsigned.Vin, TxInput{in.Txid, in.Vout, []byte{}, []byte{}, in.Sequence})
+	}
+
+	p := &PSBT{unsigned, []PSBTInput{}}
+	for _, out := range prevOuts {
+		p.Inputs = append(p.Inputs, PSBTInput{PrevOut: out, SigHashType: hashType})
+	}
+
+	return p, nil
+}
+
+func (p *PSBT) PrevOuts() []TxOutput {
+	prevOuts := []TxOutput{}
+	for _, in := range p.Inputs {
+		prevOuts = append(prevOuts, in.PrevOut)
+	}
+	return prevOuts
+}
+
+// Fee is what the inputs are worth above the outputs.
+func (p *PSBT) Fee() Amount {
+	var fee Amount
+	for _, in := range p.Inputs {
+		fee += in.PrevOut.Value
+	}
+	for _, out := range p.Tx.Vout {
+		fee -= out.Value
+	}
+	return fee
+}
+
+// Combine takes the signatures of other that p is missing.
+func (p *PSBT) Combine(other *PSBT) error {
+	if !bytes.Equal(p.Tx.Hash(), other.Tx.Hash()) || len(p.Inputs) != len(other.Inputs) {
+		return errPSBTMismatch
+	}
+
+	for inInd := range p.Inputs {
+		in := &p.Inputs[inInd]
+		theirs := other.Inputs[inInd]
+
+		if !in.IsFinal() && theirs.IsFinal() {
+			in.FinalPublicKey = theirs.FinalPublicKey
+			in.FinalSignature = theirs.FinalSignature
+			in.Partial = nil
+		}
+		if !in.IsFinal() && in.Partial == nil {
+			in.Partial = theirs.Partial
+		}
+	}
+
+	return nil
+}
+
+// Finalize turns every partial signature that verifies into the final one
+// and returns how many inputs are still missing theirs.
+func (p *PSBT) Finalize() int {
+	prevOuts := p.PrevOuts()
+	missing := 0
+
+	for inInd := range p.Inputs {
+		in := &p.Inputs[inInd]
+		if in.IsFinal() {
+			continue
+		}
+		if in.Partial == nil {
+			missing++
+			continue
+		}
+
+		// verify on a copy, the unsigned transaction stays unsigned
+		tx := &Transaction{p.Tx.ID, append([]TxInput{}, p.Tx.Vin...), p.Tx.Vout}
+		tx.Vin[inInd].PublicKey = in.Partial.PublicKey
+		tx.Vin[inInd].Signature = in.Partial.Signature
+
+		if tx.verifyInput(inInd, prevOuts) != nil {
+			missing++
+			continue
+		}
+
+		in.FinalPublicKey = in.Partial.PublicKey
+		in.FinalSignature = in.Partial.Signature
+		in.Partial = nil
+	}
+
+	return missing
+}
+
+// Extract returns the signed transaction once every input is final.
+func (p *PSBT) Extract() (*Transaction, error) {
+	tx := &Transaction{p.Tx.ID, []TxInput{}, p.Tx.Vout}
+
+	for inInd, in := range p.Inputs {
+		if !in.IsFinal() {
+			return nil, errPSBTNotFinal
+		}
+
+		txin := p.Tx.Vin[inInd]
+		tx.Vin = append(tx.Vin, TxInput{txin.Txid, txin.Vout, in.FinalSignature, in.FinalPublicKey, txin.Sequence})
+	}
+
+	return tx, nil
+}
+
+// SignPSBT signs the inputs spending outputs of the wallet, with the
+// previous outputs the container carries. It returns how many it signed.
+func (wallets *NFC_Wallets) SignPSBT(p *PSBT) (int, error) {
+	prevOuts := p.PrevOuts()
+	signed := 0
+
+	for inInd := range p.Inputs {
+		in := &p.Inputs[inInd]
+		if in.IsFinal() {
+			continue
+		}
+
+		address := NewPubKeyHashAddress(in.PrevOut.PubKeyHash).String()
+		wallet, ok := wallets.GetWallet(address)
+		if !ok {
+			continue
+		}
+
+		signer, err := wallets.GetSigner(address)
+		if err != nil {
+			return 0, err
+		}
+
+		hashToSign, err := p.Tx.SigHash(inInd, in.SigHashType, prevOuts)
+		if err != nil {
+			return 0, err
+		}
+
+		signature, err := signer.Sign(hashToSign)
+		if err != nil {
+			return 0, err
+		}
+
+		in.Partial = &PartialSig{wallet.PublicKey, append(signature, in.SigHashType)}
+		signed++
+	}
+
+	return signed, nil
+}
+
+func (p *PSBT) Encode() string {
+	var result bytes.Buffer
+
+	result.Write(psbtMagic)
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(p)
+
+	return base64.StdEncoding.EncodeToString(result.Bytes())
+}
+
+func DecodePSBT(encoded string) (*PSBT, error) {
+	buffer, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !bytes.HasPrefix(buffer, psbtMagic) {
+		return nil, errBadPSBT
+	}
+
+	var p PSBT
+	decoder := gob.NewDecoder(bytes.NewReader(buffer[len(psbtMagic):]))
+	if err := decoder.Decode(&p); err != nil || p.Tx == nil || len(p.Inputs) != len(p.Tx.Vin) {
+		return nil, errBadPSBT
+	}
+
+	return &p, nil
+}
+
+type PSBTInputJSON struct {
+	Address string `json:"address"`
+	Value   Amount `json:"value"`
+	SigHash string `json:"sighash"`
+	// unsigned, signed or final
+	Status    string `json:"status"`
+	PublicKey string `json:"publickey,omitempty"`
+}
+
+type PSBTJSON struct {
+	Tx       *RawTx          `json:"tx"`
+	Inputs   []PSBTInputJSON `json:"inputs"`
+	Fee      Amount          `json:"fee"`
+	Complete bool            `json:"complete"`
+}
+
+func (p *PSBT) JSON() ([]byte, error) {
+	out := PSBTJSON{Tx: NewRawTx(p.Tx), Inputs: []PSBTInputJSON{}, Fee: p.Fee(), Complete: true}
+
+	for _, in := range p.Inputs {
+		input := PSBTInputJSON{
+			Address: NewPubKeyHashAddress(in.PrevOut.PubKeyHash).String(),
+			Value:   in.PrevOut.Value,
+			SigHash: SigHashTypeName(in.SigHashType),
+			Status:  "unsigned",
+		}
+
+		switch {
+		case in.IsFinal():
+			input.Status = "final"
+			input.PublicKey = hex.EncodeToString(in.FinalPublicKey)
+		case in.Partial != nil:
+			input.Status = "signed"
+			input.PublicKey = hex.EncodeToString(in.Partial.PublicKey)
+		}
+		if !in.IsFinal() {
+			out.Complete = false
+		}
+
+		out.Inputs = append(out.Inputs, input)
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
@@ -0,0 +1,110 @@
+package main
+
+import "testing"
+import "bytes"
+
+// psbtTestTx spends one output of each wallet.
+func psbtTestTx(wallets ...*Wallet) (*Transaction, []TxOutput) {
+	tx := &Transaction{[]byte{}, []TxInput{}, []TxOutput{{9, bytes.Repeat([]byte{0x11}, pubKeyHashLen)}}}
+	prevOuts := []TxOutput{}
+	for vout, w := range wallets {
+		tx.Vin = append(tx.Vin, TxInput{[]byte{0xaa, 0xbb}, vout, []byte{}, []byte{}, SequenceFinal})
+		prevOuts = append(prevOuts, TxOutput{5, HashPubKey(w.PublicKey)})
+	}
+	tx.SetID()
+	return tx, prevOuts
+}
+
+func TestPSBTTwoSigners(t *testing.T) {
+	first, second := NewWallet(), NewWallet()
+	firstSigner := &NFC_Wallets{Wallets: map[string]*Wallet{first.GetAddress(): first}}
+	secondSigner := &NFC_Wallets{Wallets: map[string]*Wallet{second.GetAddress(): second}}
+
+	tx, prevOuts := psbtTestTx(first, second)
+	p, err := NewPSBT(tx, prevOuts, SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Fee() != 1 {
+		t.Errorf("fee %d, want 1", p.Fee())
+	}
+	encoded := p.Encode()
+
+	// each signer works on its own copy
+	signed := []*PSBT{}
+	for _, signer := range []*NFC_Wallets{firstSigner, secondSigner} {
+		copied, err := DecodePSBT(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := signer.SignPSBT(copied); n != 1 || err != nil {
+			t.Fatalf("signed %d inputs, %v, want 1", n, err)
+		}
+		signed = append(signed, copied)
+	}
+
+	combined, _ := DecodePSBT(signed[0].Encode())
+	if missing := combined.Finalize(); missing != 1 {
+		t.Fatalf("%d inputs missing before combining, want 1", missing)
+	}
+	if _, err := combined.Extract(); err != errPSBTNotFinal {
+		t.Fatalf("extract before combining: got %v, want %v", err, errPSBTNotFinal)
+	}
+
+	if err := combined.Combine(signed[1]); err != nil {
+		t.Fatal(err)
+	}
+	if missing := combined.Finalize(); missing != 0 {
+		t.Fatalf("%d inputs missing after combining", missing)
+	}
+
+	final, err := combined.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(final.ID, tx.ID) || !final.VerifyWithPrevOutputs(prevOuts) {
+		t.Fatalf("extracted transaction doesn't verify")
+	}
+}
+
+func TestPSBTBadSignatureNotFinalized(t *testing.T) {
+	w := NewWallet()
+	signer := &NFC_Wallets{Wallets: map[string]*Wallet{w.GetAddress(): w}}
+
+	tx, prevOuts := psbtTestTx(w)
+	p, _ := NewPSBT(tx, prevOuts, SigHashAll)
+	if _, err := signer.SignPSBT(p); err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].Partial.Signature[0] ^= 1
+
+	if missing := p.Finalize(); missing != 1 {
+		t.Fatalf("%d inputs missing, want the tampered one", missing)
+	}
+}
+
+func TestPSBTCombineDifferentTransaction(t *testing.T) {
+	first, second := NewWallet(), NewWallet()
+
+	tx, prevOuts := psbtTestTx(first, second)
+	p, _ := NewPSBT(tx, prevOuts, SigHashAll)
+
+	other, otherPrevOuts := psbtTestTx(first, second)
+	other.Vout[0].Value = 8
+	other.SetID()
+	q, _ := NewPSBT(other, otherPrevOuts, SigHashAll)
+
+	if err := p.Combine(q); err != errPSBTMismatch {
+		t.Errorf("different outputs: got %v, want %v", err, errPSBTMismatch)
+	}
+
+	fewer, fewerPrevOuts := psbtTestTx(first)
+	q, _ = NewPSBT(fewer, fewerPrevOuts, SigHashAll)
+	if err := p.Combine(q); err != errPSBTMismatch {
+		t.Errorf("fewer inputs: got %v, want %v", err, errPSBTMismatch)
+	}
+
+	if _, err := DecodePSBT("bm90IGEgcHNidA=="); err != errBadPSBT {
+		t.Errorf("decoding garbage: got %v, want %v", err, errBadPSBT)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import "bytes"
+import "errors"
+import "sort"
+import "strconv"
+import "strings"
+import "encoding/gob"
+import "encoding/hex"
+import "encoding/json"
+
+// a raw transaction is the gob encoding of a Transaction in hex. It can be
+// built on one node, signed on another that holds the keys, even offline,
+// and broadcast from a third.
+
+var errBadRawTransaction = errors.New("not a hex encoded transaction")
+var errNoInputs = errors.New("no inputs given")
+var errDuplicateInput = errors.New("the same outpoint is spent twice")
+var errBadPrevOut = errors.New("previous outputs are TXID:VOUT:ADDRESS:AMOUNT")
+var errUnknownPrevOut = errors.New("an input spends an output the node doesn't know, give it with -prevouts")
+var errBadSigHashName = errors.New("sighash types are ALL, NONE or SINGLE, optionally with |ANYONECANPAY")
+var errRawCoinbase = errors.New("coinbase transactions can only be mined")
+var errInputsSpent = errors.New("an input is already spent or doesn't exist")
+var errBadOutputValue = errors.New("outputs must be worth more than 0")
+var errOutputsExceedInputs = errors.New("the outputs are worth more than the inputs")
+
+var sigHashNames = map[string]byte{
+	"ALL":    SigHashAll,
+	"NONE":   SigHashNone,
+	"SINGLE": SigHashSingle,
+}
+
+// ParseSigHashType parses names like "ALL" or "SINGLE|ANYONECANPAY".
+func ParseSigHashType(name string) (byte, error) {
+	parts := strings.Split(strings.ToUpper(name), "|")
+
+	hashType, ok := sigHashNames[parts[0]]
+	if !ok || len(parts) > 2 {
+		return 0, errBadSigHashName
+	}
+
+	if len(parts) == 2 {
+		if parts[1] != "ANYONECANPAY" {
+			return 0, errBadSigHashName
+		}
+		hashType |= SigHashAnyoneCanPay
+	}
+
+	return hashType, nil
+}
+
+func SigHashTypeName(hashType byte) string {
+	name := ""
+	for n, t := range sigHashNames {
+		if t == hashType&sigHashMask {
+			name = n
+		}
+	}
+	if name == "" {
+		name = strconv.Itoa(int(hashType & sigHashMask))
+	}
+
+	if hashType&SigHashAnyoneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+func EncodeRawTransaction(tx *Transaction) string {
+	return hex.EncodeToString(tx.Serialize())
+}
+
+func DecodeRawTransaction(raw string) (*Transaction, error) {
+	buffer, err := hex.DecodeString(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, errBadRawTransaction
+	}
+
+	var tx Transaction
+	if err := gob.NewDecoder(bytes.NewReader(buffer)).Decode(&tx); err != nil {
+		return nil, errBadRawTransaction
+	}
+
+	return &tx, nil
+}
+
+// CreateRawTransaction builds the unsigned transaction spending exactly
+// outpoints, with sequence, and paying payees, with no change output.
+// Inputs get their public keys when they are signed.
+func CreateRawTransaction(outpoints []string, payees map[string]Amount, sequence uint32) (*Transaction, error) {
+	if len(outpoints) == 0 {
+		return nil, errNoInputs
+	}
+	if len(payees) == 0 {
+		return nil, errNoPayees
+	}
+
+	var inputs []TxInput
+	seen := make(map[string]bool)
+	for _, outpoint := range outpoints {
+		txid, vout, err := splitOutpoint(outpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		key := outpointKey(txid, vout)
+		if seen[key] {
+			return nil, errDuplicateInput
+		}
+		seen[key] = true
+
+		inputs = append(inputs, TxInput{txid, vout, []byte{}, []byte{}, sequence})
+	}
+
+	addresses := []string{}
+	for address := range payees {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	var outputs []TxOutput
+	for _, address := range addresses {
+		pubKeyHash, err := payeePubKeyHash(address)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, TxOutput{payees[address], pubKeyHash})
+	}
+
+	tx := &Transaction{[]byte{}, inputs, outputs}
+	tx.SetID()
+
+	return tx, nil
+}
+
+// ParsePrevOuts parses "txid:vout:address:amount" entries, the outputs a
+// node without the chain needs to sign.
+func ParsePrevOuts(list string) (map[string]TxOutput, error) {
+	prevOuts := make(map[string]TxOutput)
+	if list == "" {
+		return prevOuts, nil
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 4 {
+			return nil, errBadPrevOut
+		}
+
+		key, err := ParseOutpoint(parts[0] + ":" + parts[1])
+		if err != nil {
+			return nil, errBadPrevOut
+		}
+
+		decoded, err := DecodeAddress(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		pubKeyHash, err := decoded.PubKeyHash()
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := ParseAmount(parts[3])
+		if err != nil || amount <= 0 {
+			return nil, errBadPrevOut
+		}
+
+		prevOuts[key] = TxOutput{amount, pubKeyHash}
+	}
+
+	return prevOuts, nil
+}
+
+// RawPrevOutputs returns the outputs tx spends, in input order, from known
+// or else from the UTXO set.
+func RawPrevOutputs(tx *Transaction, known map[string]TxOutput, utxoset *UTXOSet) ([]TxOutput, error) {
+	prevOuts := []TxOutput{}
+
+	for _, in := range tx.Vin {
+		key := outpointKey(in.Txid, in.Vout)
+
+		if out, ok := known[key]; ok {
+			prevOuts = append(prevOuts, out)
+			continue
+		}
+		if utxoset != nil {
+			if utxo, ok := utxoset.FindOutpoint(key); ok {
+				prevOuts = append(prevOuts, utxo.Output)
+				continue
+			}
+		}
+		return nil, errUnknownPrevOut
+	}
+
+	return prevOuts, nil
+}
+
+// SignRawTransaction signs the inputs spending outputs of the wallet and
+// leaves the others as they are, another wallet may sign them. It returns
+// how many inputs still don't verify.
+func (wallets *NFC_Wallets) SignRawTransaction(tx *Transaction, hashType byte, prevOuts []TxOutput) (int, error) {
+	if len(prevOuts) != len(tx.Vin) {
+		return 0, errPrevOutputs
+	}
+
+	for inInd, prevOut := range prevOuts {
+		address := NewPubKeyHashAddress(prevOut.PubKeyHash).String()
+
+		wallet, ok := wallets.GetWallet(address)
+		if !ok {
+			continue
+		}
+
+		signer, err := wallets.GetSigner(address)
+		if err != nil {
+			return 0, err
+		}
+
+		hashToSign, err := tx.SigHash(inInd, hashType, prevOuts)
+		if err != nil {
+			return 0, err
+		}
+
+		signature, err := signer.Sign(hashToSign)
+		if err != nil {
+			return 0, err
+		}
+
+		tx.Vin[inInd].PublicKey = wallet.PublicKey
+		tx.Vin[inInd].Signature = append(signature, hashType)
+	}
+
+	unsigned := 0
+	for inInd := range tx.Vin {
+		if tx.verifyInput(inInd, prevOuts) != nil {
+			unsigned++
+		}
+	}
+
+	return unsigned, nil
+}
+
+// CheckRawTransaction is what a transaction from outside the wallet must
+// pass before it goes into the mempool. It may spend outputs of mempool
+// transactions, the miner puts it in a block with its parents.
+func CheckRawTransaction(tx *Transaction, bc *BlockChain, utxoset *UTXOSet, mempool *Mempool) error {
+	if tx.IsCoinbase() {
+		return errRawCoinbase
+	}
+
+	if err := CheckTransaction(tx); err != nil {
+		return err
+	}
+
+	pending := mempool.Transactions()
+	prevOutMap := bc.FindPreviousOutputs(append([]*Transaction{tx}, pending...))
+
+	if failures := VerifyTransactionsWithPrevOutputs([]*Transaction{tx}, prevOutMap); len(failures) > 0 {
+		return failures[0]
+	}
+
+	inMempool := make(map[string]bool)
+	for _, pendingTx := range pending {
+		inMempool[hex.EncodeToString(pendingTx.ID)] = true
+	}
+	for _, in := range tx.Vin {
+		if !inMempool[hex.EncodeToString(in.Txid)] && !utxoset.HasInput(in) {
+			return errInputsSpent
+		}
+	}
+
+	for _, txout := range tx.Vout {
+		if txout.Value <= 0 {
+			return errBadOutputValue
+		}
+	}
+
+	fee, err := TxFee(tx, prevOutMap)
+	if err != nil {
+		return err
+	}
+	if fee < 0 {
+		return errOutputsExceedInputs
+	}
+
+	return nil
+}
+
+type RawTxInput struct {
+	TxID      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	Sequence  uint32 `json:"sequence"`
+	Address   string `json:"address,omitempty"`
+	PublicKey string `json:"publickey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	SigHash   string `json:"sighash,omitempty"`
+}
+
+type RawTxOutput struct {
+	N          int    `json:"n"`
+	Value      Amount `json:"value"`
+	Address    string `json:"address"`
+	PubKeyHash string `json:"pubkeyhash"`
+}
+
+// RawTx is the readable form decoderawtransaction prints.
+type RawTx struct {
+	TxID     string `json:"txid"`
+	Hash     string `json:"hash"`
+	Coinbase bool   `json:"coinbase"`
+	// see Transaction.SignalsReplacement
+	Replaceable bool          `json:"replaceable"`
+	Vin         []RawTxInput  `json:"vin"`
+	Vout        []RawTxOutput `json:"vout"`
+}
+
+func NewRawTx(tx *Transaction) *RawTx {
+	raw := &RawTx{
+		TxID:        hex.EncodeToString(tx.ID),
+		Hash:        hex.EncodeToString(tx.Hash()),
+		Coinbase:    tx.IsCoinbase(),
+		Replaceable: tx.SignalsReplacement(),
+		Vin:         []RawTxInput{},
+		Vout:        []RawTxOutput{},
+	}
+
+	for _, in := range tx.Vin {
+		input := RawTxInput{TxID: hex.EncodeToString(in.Txid), Vout: in.Vout, Sequence: in.GetSequence()}
+
+		if len(in.PublicKey) > 0 {
+			input.Address = NewPubKeyHashAddress(HashPubKey(in.PublicKey)).String()
+			input.PublicKey = hex.EncodeToString(in.PublicKey)
+		}
+
+		// the last byte of the signature is the sighash type
+		if signLen := len(in.Signature) - 1; signLen > 0 {
+			input.Signature = hex.EncodeToString(in.Signature[:signLen])
+			input.SigHash = SigHashTypeName(in.Signature[signLen])
+		}
+
+		raw.Vin = append(raw.Vin, input)
+	}
+
+	for outInd, out := range tx.Vout {
+		raw.Vout = append(raw.Vout, RawTxOutput{outInd, out.Value, NewPubKeyHashAddress(out.PubKeyHash).String(), hex.EncodeToString(out.PubKeyHash)})
+	}
+
+	return raw
+}
+
+func (raw *RawTx) JSON() ([]byte, error) {
+	return json.MarshalIndent(raw, "", "  ")
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+import "bytes"
+
+func TestCreateRawTransaction(t *testing.T) {
+	first := NewPubKeyHashAddress(bytes.Repeat([]byte{0x11}, pubKeyHashLen)).String()
+	second := NewPubKeyHashAddress(bytes.Repeat([]byte{0x22}, pubKeyHashLen)).String()
+	payees := map[string]Amount{second: 7, first: 5}
+
+	tx, err := CreateRawTransaction([]string{"aabb:0", "aabb:1"}, payees, SequenceFinal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Vin) != 2 || len(tx.Vout) != 2 {
+		t.Fatalf("%d inputs and %d outputs, want 2 and 2", len(tx.Vin), len(tx.Vout))
+	}
+	// outputs are sorted by address, so the same call gives the same tx
+	want := []Amount{5, 7}
+	if second < first {
+		want = []Amount{7, 5}
+	}
+	if tx.Vout[0].Value != want[0] || tx.Vout[1].Value != want[1] {
+		t.Errorf("outputs %v, want %v", tx.Vout, want)
+	}
+
+	decoded, err := DecodeRawTransaction(EncodeRawTransaction(tx))
+	if err != nil || !bytes.Equal(decoded.ID, tx.ID) {
+		t.Errorf("round trip: %v, %v", decoded, err)
+	}
+
+	tests := []struct {
+		name      string
+		outpoints []string
+		payees    map[string]Amount
+		err       error
+	}{
+		{"duplicate input", []string{"aabb:0", "aabb:1", "aabb:0"}, payees, errDuplicateInput},
+		{"duplicate in uppercase", []string{"aabb:0", "AABB:0"}, payees, errDuplicateInput},
+		{"no inputs", []string{}, payees, errNoInputs},
+		{"no payees", []string{"aabb:0"}, map[string]Amount{}, errNoPayees},
+		{"bad address", []string{"aabb:0"}, map[string]Amount{"nowhere": 5}, errBadPayee},
+	}
+
+	for _, test := range tests {
+		if _, err := CreateRawTransaction(test.outpoints, test.payees, SequenceFinal); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	if _, err := CreateRawTransaction([]string{"aabb"}, payees, SequenceFinal); err == nil {
+		t.Errorf("outpoint without vout accepted")
+	}
+}
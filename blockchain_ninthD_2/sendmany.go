@@ -0,0 +1,173 @@
+package main
+
+import "errors"
+import "sort"
+import "strings"
+import "encoding/hex"
+
+var errNoPayees = errors.New("no payees given")
+var errBadPayee = errors.New("payees are ADDRESS=AMOUNT pairs with valid addresses and positive amounts")
+var errDuplicatePayee = errors.New("the same address is paid twice")
+var errNoSources = errors.New("none of the source addresses holds coins")
+var errInsufficientFunds = errors.New("balance isn't enough to pay for this transaction")
+
+// ParsePayees parses "addr=amount,addr=amount" into the map sendmany takes.
+func ParsePayees(list string) (map[string]Amount, error) {
+	payees := make(map[string]Amount)
+
+	for _, pair := range strings.Split(list, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errBadPayee
+		}
+
+		amount, err := ParseAmount(parts[1])
+		if err != nil || amount <= 0 {
+			return nil, errBadPayee
+		}
+
+		pubKeyHash, err := payeePubKeyHash(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		address := NewPubKeyHashAddress(pubKeyHash).String()
+		if _, ok := payees[address]; ok {
+			return nil, errDuplicatePayee
+		}
+		payees[address] = amount
+	}
+
+	return payees, nil
+}
+
+// payeePubKeyHash is what address pays to, errBadPayee when it can't be
+// paid to.
+func payeePubKeyHash(address string) ([]byte, error) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, errBadPayee
+	}
+
+	pubKeyHash, err := decoded.PubKeyHash()
+	if err != nil {
+		return nil, errBadPayee
+	}
+
+	return pubKeyHash, nil
+}
+
+// NewSendManyTransaction pays every payee out of the coins of the source
+// addresses, all spendable addresses of the wallet when sources is empty.
+// Change goes to a fresh change address and fee to the miner.
+func NewSendManyTransaction(sources []string, payees map[string]Amount, fee Amount, sequence uint32, selector CoinSelector, utxoset *UTXOSet, mempool *Mempool) (*Transaction, error) {
+	if len(payees) == 0 {
+		return nil, errNoPayees
+	}
+
+	if len(sources) == 0 {
+		sources = Nfc_wallets.Addresses()
+	}
+
+	utxos := []UTXO{}
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		wallet, ok := Nfc_wallets.GetWallet(source)
+		if !ok {
+			if _, ok := Nfc_wallets.GetWatchedAddress(source); ok {
+				return nil, errWatchOnly
+			}
+			return nil, errNotOwned
+		}
+
+		if seen[wallet.GetAddress()] {
+			continue
+		}
+		seen[wallet.GetAddress()] = true
+
+		utxos = append(utxos, utxoset.FindUTXO(source)...)
+	}
+	if len(utxos) == 0 {
+		return nil, errNoSources
+	}
+
+	total := fee
+	for _, amount := range payees {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	acc, validUtxo := selector.Select(AvailableUTXOs(utxos, mempool), total)
+	if acc < total {
+		return nil, errInsufficientFunds
+	}
+
+	var inputs []TxInput
+	prevOuts := []TxOutput{}
+	for _, utxo := range validUtxo {
+		txid, _ := hex.DecodeString(utxo.TxStr)
+		wallet, _ := Nfc_wallets.GetWallet(NewPubKeyHashAddress(utxo.Output.PubKeyHash).String())
+
+		inputs = append(inputs, TxInput{txid, utxo.OutInd, []byte{}, wallet.PublicKey, sequence})
+		prevOuts = append(prevOuts, utxo.Output)
+	}
+
+	// a stable output order, maps iterate randomly
+	addresses := []string{}
+	for address := range payees {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	var outputs []TxOutput
+	for _, address := range addresses {
+		pubKeyHash, err := payeePubKeyHash(address)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, TxOutput{payees[address], pubKeyHash})
+	}
+
+	if acc > total {
+		change, err := Nfc_wallets.NewChangeAddress()
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, TxOutput{acc - total, AddressPubKeyHash(change)})
+	}
+
+	tx := &Transaction{[]byte{}, inputs, outputs}
+	tx.SetID()
+
+	if err := Nfc_wallets.SignTransaction(tx, SigHashAll, prevOuts); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// SignTransaction signs every input of tx with the key of the wallet its
+// public key belongs to.
+func (wallets *NFC_Wallets) SignTransaction(tx *Transaction, hashType byte, prevOuts []TxOutput) error {
+	for inInd, in := range tx.Vin {
+		signer, err := wallets.GetSigner(NewPubKeyHashAddress(HashPubKey(in.PublicKey)).String())
+		if err != nil {
+			return err
+		}
+
+		hashToSign, err := tx.SigHash(inInd, hashType, prevOuts)
+		if err != nil {
+			return err
+		}
+
+		signature, err := signer.Sign(hashToSign)
+		if err != nil {
+			return err
+		}
+
+		tx.Vin[inInd].Signature = append(signature, hashType)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+import "bytes"
+import "strings"
+
+func TestParsePayees(t *testing.T) {
+	first := NewPubKeyHashAddress(bytes.Repeat([]byte{0x11}, pubKeyHashLen)).String()
+	second := NewPubKeyHashAddress(bytes.Repeat([]byte{0x22}, pubKeyHashLen)).String()
+	testnet := (&Address{PubKeyHashAddress, bytes.Repeat([]byte{0x11}, pubKeyHashLen), TestNet, 0}).String()
+
+	payees, err := ParsePayees(first + "=5," + second + "=7")
+	if err != nil || len(payees) != 2 || payees[first] != 5*Coin || payees[second] != 7*Coin {
+		t.Fatalf("got %v, %v", payees, err)
+	}
+
+	tests := []struct {
+		name string
+		list string
+		err  error
+	}{
+		{"duplicate", first + "=5," + second + "=7," + first + "=1", errDuplicatePayee},
+		{"duplicate in uppercase", first + "=5," + strings.ToUpper(first) + "=1", errDuplicatePayee},
+		{"no amount", first, errBadPayee},
+		{"empty amount", first + "=", errBadPayee},
+		{"zero", first + "=0", errBadPayee},
+		{"negative", first + "=-5", errBadPayee},
+		{"not a number", first + "=five", errBadPayee},
+		{"too many decimals", first + "=0.000000001", errBadPayee},
+		{"trailing comma", first + "=5,", errBadPayee},
+		{"bad checksum", first[:len(first)-1] + "x=5", errBadPayee},
+		{"not an address", "nowhere=5", errBadPayee},
+		{"other network", testnet + "=5", errBadPayee},
+	}
+
+	for _, test := range tests {
+		if _, err := ParsePayees(test.list); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
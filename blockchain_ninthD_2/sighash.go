@@ -0,0 +1,110 @@
+package main
+
+import "bytes"
+import "errors"
+import "crypto/sha256"
+import "encoding/binary"
+
+const (
+	SigHashAll          byte = 0x01
+	SigHashNone         byte = 0x02
+	SigHashSingle       byte = 0x03
+	SigHashAnyoneCanPay byte = 0x80
+
+	sigHashMask byte = 0x1f
+)
+
+var errSigHashSingle = errors.New("SIGHASH_SINGLE input has no matching output")
+var errSigHashType = errors.New("unknown sighash type")
+var errPrevOutputs = errors.New("previous outputs don't match the inputs")
+
+// SigHash returns the digest signed by input inInd.
+// prevOuts[i] must be the output spent by tx.Vin[i].
+//
+// Every field is written with a fixed width or a length prefix, so two
+// different transactions can't produce the same message:
+//
+//	hashType(1) | inInd(4)
+//	nIn(4) | for each committed input: txid | vout(4) | value(8) | pubKeyHash
+//	nOut(4) | for each committed output: value(8) | pubKeyHash
+//	[for each committed input: sequence(4)]
+//
+// the sequences are only written when a committed input isn't final, see
+// TxInput.GetSequence, so signatures made before sequences still verify.
+// byte slices are written as len(4) | bytes. With SIGHASH_ANYONECANPAY
+// only input inInd is committed. SIGHASH_NONE commits to no output and
+// SIGHASH_SINGLE only to the output with the same index as the input.
+func (tx *Transaction) SigHash(inInd int, hashType byte, prevOuts []TxOutput) ([]byte, error) {
+	if len(prevOuts) != len(tx.Vin) || inInd < 0 || inInd >= len(tx.Vin) {
+		return nil, errPrevOutputs
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(hashType)
+	writeUint32(&buf, uint32(inInd))
+
+	inputs := []int{}
+	if hashType&SigHashAnyoneCanPay != 0 {
+		inputs = append(inputs, inInd)
+	} else {
+		for ind := range tx.Vin {
+			inputs = append(inputs, ind)
+		}
+	}
+
+	committed := []TxInput{}
+	writeUint32(&buf, uint32(len(inputs)))
+	for _, ind := range inputs {
+		in := tx.Vin[ind]
+		committed = append(committed, in)
+		writeVarBytes(&buf, in.Txid)
+		writeUint32(&buf, uint32(in.Vout))
+		writeUint64(&buf, uint64(prevOuts[ind].Value))
+		writeVarBytes(&buf, prevOuts[ind].PubKeyHash)
+	}
+
+	outputs := []TxOutput{}
+	switch hashType & sigHashMask {
+	case SigHashAll:
+		outputs = tx.Vout
+	case SigHashNone:
+	case SigHashSingle:
+		if inInd >= len(tx.Vout) {
+			return nil, errSigHashSingle
+		}
+		outputs = tx.Vout[inInd : inInd+1]
+	default:
+		return nil, errSigHashType
+	}
+
+	writeUint32(&buf, uint32(len(outputs)))
+	for _, out := range outputs {
+		writeUint64(&buf, uint64(out.Value))
+		writeVarBytes(&buf, out.PubKeyHash)
+	}
+
+	writeSequences(&buf, committed)
+
+	first := sha256.Sum256(buf.Bytes())
+	digest := sha256.Sum256(first[:])
+
+	return digest[:], nil
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	buf.Write(b[:])
+}
+
+func writeVarBytes(buf *bytes.Buffer, content []byte) {
+	writeUint32(buf, uint32(len(content)))
+	buf.Write(content)
+}
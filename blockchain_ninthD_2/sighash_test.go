@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+import "encoding/hex"
+
+// the digests are fixed: a change to SigHash breaks every signature made
+// before it, so it must show up here
+
+func sigHashTestTx(sequence uint32) (*Transaction, []TxOutput) {
+	tx := &Transaction{
+		[]byte{0x01, 0x02},
+		[]TxInput{
+			{[]byte{0xaa, 0xaa}, 0, []byte{}, []byte{}, sequence},
+			{[]byte{0xbb, 0xbb}, 1, []byte{}, []byte{}, sequence},
+		},
+		[]TxOutput{
+			{3 * Coin, []byte{0x11, 0x11}},
+		},
+	}
+	prevOuts := []TxOutput{
+		{2 * Coin, []byte{0x22, 0x22}},
+		{Coin + 50000000, []byte{0x33, 0x33}},
+	}
+	return tx, prevOuts
+}
+
+func TestSigHashDigests(t *testing.T) {
+	tests := []struct {
+		name     string
+		sequence uint32
+		inInd    int
+		hashType byte
+		digest   string
+	}{
+		{"ALL", SequenceFinal, 0, SigHashAll, "45bddb0cc53a7ffc6a690f5432548f1e6564914f872992ea15e0bf7d7133a87e"},
+		{"ALL|ANYONECANPAY", SequenceFinal, 0, SigHashAll | SigHashAnyoneCanPay, "b20c2484f0ffa473fbe045684bdcde5dac92ab7da35a22d15a79737d051ff719"},
+		{"NONE", SequenceFinal, 0, SigHashNone, "1fa724390825479801667c8507be9095eb79c65f1f05608f75eab0c8c4afffba"},
+		{"NONE|ANYONECANPAY", SequenceFinal, 0, SigHashNone | SigHashAnyoneCanPay, "db566e849543a925238edabd4d61398345d051da915252547391193923486736"},
+		{"SINGLE", SequenceFinal, 0, SigHashSingle, "8d2746c78f3a3519ccb8a544a752ce026b1225964c00d39699860d9123031bcc"},
+		{"SINGLE|ANYONECANPAY", SequenceFinal, 0, SigHashSingle | SigHashAnyoneCanPay, "b446b6495d4caf2888ef760dd0d9f827b0f25b78f1c31b6fdc1ffd69fd72146d"},
+		{"ALL input 1", SequenceFinal, 1, SigHashAll, "4565644e8f5d96a647c456fcd2e795ef353c9c706f38ec5c3d93f5ba2abf93d7"},
+		{"ALL unset sequence", 0, 0, SigHashAll, "45bddb0cc53a7ffc6a690f5432548f1e6564914f872992ea15e0bf7d7133a87e"},
+		{"ALL replaceable", MaxRBFSequence, 0, SigHashAll, "c7335d697d76cccea638169f4d7bec75e2919d6ef07f38164413e6a8f0682116"},
+	}
+
+	for _, test := range tests {
+		tx, prevOuts := sigHashTestTx(test.sequence)
+
+		digest, err := tx.SigHash(test.inInd, test.hashType, prevOuts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := hex.EncodeToString(digest); got != test.digest {
+			t.Errorf("%s: digest %s, want %s", test.name, got, test.digest)
+		}
+	}
+}
+
+func TestSigHashSingleWithoutOutput(t *testing.T) {
+	tx, prevOuts := sigHashTestTx(SequenceFinal)
+
+	for _, hashType := range []byte{SigHashSingle, SigHashSingle | SigHashAnyoneCanPay} {
+		if _, err := tx.SigHash(1, hashType, prevOuts); err != errSigHashSingle {
+			t.Errorf("hash type %#x: got %v, want %v", hashType, err, errSigHashSingle)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import "errors"
+import "math/big"
+import "crypto/rand"
+import "crypto/ecdsa"
+import "crypto/ed25519"
+import "crypto/elliptic"
+import "github.com/btcsuite/btcd/btcec/v2"
+import "github.com/btcsuite/btcd/btcec/v2/schnorr"
+
+// the version byte of an address selects the signature scheme of its key.
+// public keys are stored as version || raw key, so the pubkey hash in an
+// output commits to the scheme as well.
+const (
+	VersionP256    byte = '1'
+	VersionEd25519 byte = '2'
+	VersionSchnorr byte = '3'
+)
+
+// keys made before signature schemes existed are P-256 X || Y with no
+// version byte. They are kept that way, their pubkey hash is what the
+// chain pays to. Exported, such a key carries VersionLegacyP256. X and Y
+// were written without their leading zeros, so a few are shorter than
+// 64 bytes, see padLegacyKey.
+const legacyKeyLen = 64
+const VersionLegacyP256 byte = '0'
+
+// versioned public keys no longer than a legacy key, a legacy key is any
+// other key of at most legacyKeyLen bytes
+var versionedKeyLens = map[byte]int{
+	VersionEd25519: 1 + ed25519.PublicKeySize,
+	VersionSchnorr: 1 + schnorr.PubKeyBytesLen,
+}
+
+var errUnknownScheme = errors.New("unknown signature scheme")
+var errPrivateKey = errors.New("invalid private key")
+
+type Signer interface {
+	// PublicKey returns the versioned public key.
+	PublicKey() []byte
+	Sign(hash []byte) ([]byte, error)
+}
+
+type Verifier interface {
+	// Verify checks signature against the raw (unversioned) public key.
+	Verify(rawPubKey, hash, signature []byte) bool
+}
+
+type SignatureScheme interface {
+	Verifier
+	Version() byte
+	Name() string
+	GenerateKey() ([]byte, error)
+	NewSigner(privateKey []byte) (Signer, error)
+}
+
+var signatureSchemes = map[byte]SignatureScheme{
+	VersionP256:    p256Scheme{},
+	VersionEd25519: ed25519Scheme{},
+	VersionSchnorr: schnorrScheme{},
+}
+
+func GetSignatureScheme(version byte) (SignatureScheme, error) {
+	if scheme, ok := signatureSchemes[version]; ok {
+		return scheme, nil
+	}
+	return nil, errUnknownScheme
+}
+
+func GetSignatureSchemeByName(name string) (SignatureScheme, error) {
+	for _, scheme := range signatureSchemes {
+		if scheme.Name() == name {
+			return scheme, nil
+		}
+	}
+	return nil, errUnknownScheme
+}
+
+func IsLegacyKey(pubKey []byte) bool {
+	if len(pubKey) == 0 || len(pubKey) > legacyKeyLen {
+		return false
+	}
+	return versionedKeyLens[pubKey[0]] != len(pubKey)
+}
+
+// padLegacyKey returns a legacy key as 32 bytes of X and 32 of Y. A
+// shorter key is split where X and Y give a point of the curve.
+func padLegacyKey(pubKey []byte) ([]byte, bool) {
+	curve := elliptic.P256()
+
+	for xLen := len(pubKey) - 32; xLen <= 32; xLen++ {
+		if xLen < 0 {
+			continue
+		}
+
+		x := new(big.Int).SetBytes(pubKey[:xLen])
+		y := new(big.Int).SetBytes(pubKey[xLen:])
+		if curve.IsOnCurve(x, y) {
+			padded := make([]byte, legacyKeyLen)
+			x.FillBytes(padded[:32])
+			y.FillBytes(padded[32:])
+			return padded, true
+		}
+	}
+
+	return nil, false
+}
+
+// KeyScheme returns the scheme of a public key, versioned or legacy.
+func KeyScheme(pubKey []byte) (SignatureScheme, error) {
+	if IsLegacyKey(pubKey) {
+		return p256Scheme{}, nil
+	}
+	if len(pubKey) < 2 {
+		return nil, errUnknownScheme
+	}
+	return GetSignatureScheme(pubKey[0])
+}
+
+// VerifySignature verifies signature with the scheme named by the version
+// byte of pubKey.
+func VerifySignature(pubKey, hash, signature []byte) bool {
+	scheme, err := KeyScheme(pubKey)
+	if err != nil {
+		return false
+	}
+
+	if IsLegacyKey(pubKey) {
+		padded, ok := padLegacyKey(pubKey)
+		return ok && scheme.Verify(padded, hash, signature)
+	}
+	return scheme.Verify(pubKey[1:], hash, signature)
+}
+
+// NewKeySigner returns the signer of privateKey, whose public key is
+// pubKey; a legacy key signs with its unversioned public key.
+func NewKeySigner(pubKey, privateKey []byte) (Signer, error) {
+	scheme, err := KeyScheme(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := scheme.NewSigner(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsLegacyKey(pubKey) {
+		return legacySigner{signer}, nil
+	}
+	return signer, nil
+}
+
+type legacySigner struct {
+	Signer
+}
+
+func (s legacySigner) PublicKey() []byte {
+	return s.Signer.PublicKey()[1:]
+}
+
+type keySigner struct {
+	publicKey []byte
+	sign      func(hash []byte) ([]byte, error)
+}
+
+func (s *keySigner) PublicKey() []byte {
+	return s.publicKey
+}
+
+func (s *keySigner) Sign(hash []byte) ([]byte, error) {
+	return s.sign(hash)
+}
+
+func versionedKey(version byte, raw []byte) []byte {
+	return append([]byte{version}, raw...)
+}
+
+// ECDSA over P-256, the scheme the chain started with.
+// signatures are r || s, keys are X || Y, each padded to 32 bytes.
+type p256Scheme struct{}
+
+func (p256Scheme) Version() byte {
+	return VersionP256
+}
+
+func (p256Scheme) Name() string {
+	return "p256"
+}
+
+func (p256Scheme) GenerateKey() ([]byte, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return private.D.FillBytes(make([]byte, 32)), nil
+}
+
+func (p256Scheme) NewSigner(privateKey []byte) (Signer, error) {
+	private, err := p256PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	public := make([]byte, 64)
+	private.PublicKey.X.FillBytes(public[:32])
+	private.PublicKey.Y.FillBytes(public[32:])
+
+	sign := func(hash []byte) ([]byte, error) {
+		r, s, err := ecdsa.Sign(rand.Reader, private, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+
+	return &keySigner{versionedKey(VersionP256, public), sign}, nil
+}
+
+func (p256Scheme) Verify(rawPubKey, hash, signature []byte) bool {
+	if len(rawPubKey) != 64 || len(signature) != 64 {
+		return false
+	}
+
+	x := new(big.Int).SetBytes(rawPubKey[:32])
+	y := new(big.Int).SetBytes(rawPubKey[32:])
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s)
+}
+
+func p256PrivateKey(privateKey []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(privateKey)
+	if len(privateKey) != 32 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errPrivateKey
+	}
+
+	private := &ecdsa.PrivateKey{D: d}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(privateKey)
+
+	return private, nil
+}
+
+// Ed25519, private keys are the 32 byte seed.
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) Version() byte {
+	return VersionEd25519
+}
+
+func (ed25519Scheme) Name() string {
+	return "ed25519"
+}
+
+func (ed25519Scheme) GenerateKey() ([]byte, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return private.Seed(), nil
+}
+
+func (ed25519Scheme) NewSigner(privateKey []byte) (Signer, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, errPrivateKey
+	}
+
+	private := ed25519.NewKeyFromSeed(privateKey)
+	public := private.Public().(ed25519.PublicKey)
+
+	sign := func(hash []byte) ([]byte, error) {
+		return ed25519.Sign(private, hash), nil
+	}
+
+	return &keySigner{versionedKey(VersionEd25519, public), sign}, nil
+}
+
+func (ed25519Scheme) Verify(rawPubKey, hash, signature []byte) bool {
+	if len(rawPubKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(rawPubKey), hash, signature)
+}
+
+// BIP340 Schnorr over secp256k1, keys are x-only.
+type schnorrScheme struct{}
+
+func (schnorrScheme) Version() byte {
+	return VersionSchnorr
+}
+
+func (schnorrScheme) Name() string {
+	return "schnorr"
+}
+
+func (schnorrScheme) GenerateKey() ([]byte, error) {
+	private, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return private.Serialize(), nil
+}
+
+func (schnorrScheme) NewSigner(privateKey []byte) (Signer, error) {
+	if len(privateKey) != 32 {
+		return nil, errPrivateKey
+	}
+
+	private, public := btcec.PrivKeyFromBytes(privateKey)
+	if private.Key.IsZero() {
+		return nil, errPrivateKey
+	}
+
+	sign := func(hash []byte) ([]byte, error) {
+		signature, err := schnorr.Sign(private, hash)
+		if err != nil {
+			return nil, err
+		}
+		return signature.Serialize(), nil
+	}
+
+	return &keySigner{versionedKey(VersionSchnorr, schnorr.SerializePubKey(public)), sign}, nil
+}
+
+func (schnorrScheme) Verify(rawPubKey, hash, signature []byte) bool {
+	public, err := schnorr.ParsePubKey(rawPubKey)
+	if err != nil {
+		return false
+	}
+
+	sig, err := schnorr.ParseSignature(signature)
+	if err != nil {
+		return false
+	}
+
+	return sig.Verify(hash, public)
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+import "bytes"
+import "math/big"
+import "crypto/x509"
+import "encoding/pem"
+
+// signerTestShortLegacyKey returns a P-256 private key whose X or Y has a
+// leading zero byte, and its public key as legacy wallets wrote it.
+func signerTestShortLegacyKey(t *testing.T) ([]byte, []byte) {
+	for {
+		privateKey, err := p256Scheme{}.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer, err := p256Scheme{}.NewSigner(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw := signer.PublicKey()[1:]
+		if raw[0] != 0 && raw[32] != 0 {
+			continue
+		}
+
+		x := new(big.Int).SetBytes(raw[:32])
+		y := new(big.Int).SetBytes(raw[32:])
+		return privateKey, append(x.Bytes(), y.Bytes()...)
+	}
+}
+
+func TestIsLegacyKey(t *testing.T) {
+	_, short := signerTestShortLegacyKey(t)
+
+	tests := []struct {
+		name   string
+		pubKey []byte
+		want   bool
+	}{
+		{"legacy", bytes.Repeat([]byte{0x01}, legacyKeyLen), true},
+		{"short legacy", short, true},
+		{"p256", NewWalletWithScheme(VersionP256).PublicKey, false},
+		{"ed25519", NewWalletWithScheme(VersionEd25519).PublicKey, false},
+		{"schnorr", NewWalletWithScheme(VersionSchnorr).PublicKey, false},
+		{"empty", []byte{}, false},
+	}
+
+	for _, test := range tests {
+		if got := IsLegacyKey(test.pubKey); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestShortLegacyKey(t *testing.T) {
+	privateKey, short := signerTestShortLegacyKey(t)
+
+	signer, err := NewKeySigner(short, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padded, ok := padLegacyKey(short)
+	if !ok || !bytes.Equal(padded, signer.PublicKey()) {
+		t.Fatalf("padded to %x, want %x", padded, signer.PublicKey())
+	}
+
+	hash := bytes.Repeat([]byte{0x42}, 32)
+	signature, err := signer.Sign(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(short, hash, signature) {
+		t.Error("the signature doesn't verify with the short key")
+	}
+
+	private, err := p256PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	serializable := SerializableWallet{string(pemEncoded), short, nil}
+	wallet := DeSerializeWallet(serializable.SerializeHelper())
+	if !bytes.Equal(wallet.PublicKey, padded) {
+		t.Errorf("loaded with public key %x, want %x", wallet.PublicKey, padded)
+	}
+	if !bytes.Equal(wallet.PrivateKey, privateKey) {
+		t.Errorf("loaded with private key %x, want %x", wallet.PrivateKey, privateKey)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import "fmt"
+import "os"
+import "bytes"
+import "errors"
+import "encoding/hex"
+import "github.com/boltdb/bolt"
+
+var errBadTxProof = errors.New("transaction proof doesn't match a header of the best chain")
+
+// LightClient only keeps block headers. Balances come from transactions
+// that full nodes prove, with merkle proofs, to be in the header chain.
+//
+// A peer can still hide that an output was spent, so balances are only as
+// fresh as the most complete peer.
+//
+// With UseFilters the client instead tests each block's compact filter
+// locally and downloads only the blocks that match, so peers don't learn
+// which addresses it watches.
+type LightClient struct {
+	headers    *HeaderStore
+	peers      []Peer
+	UseFilters bool
+}
+
+func NewLightClient(dbFile string, peers []Peer) *LightClient {
+	db, err := bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	return &LightClient{NewHeaderStore(db), peers, false}
+}
+
+func (lc *LightClient) Close() {
+	lc.headers.db.Close()
+}
+
+func (lc *LightClient) SyncHeaders() {
+	SyncHeaders(lc.headers, lc.peers)
+}
+
+// VerifyTxProof checks that proof.Tx is committed to by a header on the
+// best header chain.
+func (lc *LightClient) VerifyTxProof(proof *TxProof) error {
+	header, _, found := lc.headers.GetHeader(proof.BlockHash)
+	if !found || !lc.headers.InBestChain(proof.BlockHash) {
+		return errBadTxProof
+	}
+
+	if bytes.Compare(proof.Proof.Root(proof.Tx.Hash()), header.MerkleRoot[:]) != 0 {
+		return errBadTxProof
+	}
+
+	return nil
+}
+
+func (lc *LightClient) FindUTXO(address string) []UTXO {
+	if lc.UseFilters {
+		return lc.findUTXOWithFilters(address)
+	}
+	return lc.findUTXOWithProofs(address)
+}
+
+// findUTXOWithProofs asks every peer for the transactions touching address
+// and returns the outputs to address that no proven transaction spends.
+func (lc *LightClient) findUTXOWithProofs(address string) []UTXO {
+	pubKeyHash := AddressPubKeyHash(address)
+
+	txs := make(map[string]*Transaction)
+	for _, peer := range lc.peers {
+		proofs, err := peer.GetTxProofs([][]byte{pubKeyHash})
+		if err != nil {
+			fmt.Printf("peer %s: %s\n", peer.Name(), err)
+			continue
+		}
+
+		for _, proof := range proofs {
+			if err := lc.VerifyTxProof(&proof); err != nil {
+				fmt.Printf("peer %s: %s\n", peer.Name(), err)
+				continue
+			}
+			txs[hex.EncodeToString(proof.Tx.ID)] = proof.Tx
+		}
+	}
+
+	spent := make(map[string]bool)
+	for _, tx := range txs {
+		for _, in := range tx.Vin {
+			spent[outpointKey(in.Txid, in.Vout)] = true
+		}
+	}
+
+	utxos := []UTXO{}
+	for txstr, tx := range txs {
+		for outInd, out := range tx.Vout {
+			if bytes.Compare(out.PubKeyHash, pubKeyHash) == 0 && !spent[outpointKey(tx.ID, outInd)] {
+				utxos = append(utxos, UTXO{txstr, outInd, out})
+			}
+		}
+	}
+
+	return utxos
+}
+
+// findUTXOWithFilters walks the best header chain from genesis. A block is
+// only fetched when its filter matches the address or one of the outputs
+// found so far, which is how spends of them show up.
+func (lc *LightClient) findUTXOWithFilters(address string) []UTXO {
+	pubKeyHash := AddressPubKeyHash(address)
+	utxos := make(map[string]UTXO)
+
+	for _, hash := range lc.headers.BestChain() {
+		entries := [][]byte{pubKeyHash}
+		for _, utxo := range utxos {
+			txid, _ := hex.DecodeString(utxo.TxStr)
+			entries = append(entries, filterOutpoint(txid, utxo.OutInd))
+		}
+
+		block := lc.fetchMatchingBlock(hash, entries)
+		if block == nil {
+			continue
+		}
+
+		for _, tx := range block.Transactions {
+			for _, in := range tx.Vin {
+				delete(utxos, outpointKey(in.Txid, in.Vout))
+			}
+			for outInd, out := range tx.Vout {
+				if bytes.Compare(out.PubKeyHash, pubKeyHash) == 0 {
+					utxos[outpointKey(tx.ID, outInd)] = UTXO{hex.EncodeToString(tx.ID), outInd, out}
+				}
+			}
+		}
+	}
+
+	result := []UTXO{}
+	for _, utxo := range utxos {
+		result = append(result, utxo)
+	}
+	return result
+}
+
+// fetchMatchingBlock returns the block with hash if its filter matches
+// entries, nil otherwise. Filters aren't committed to by the headers, a
+// peer can hide a block by sending a filter that doesn't match: with more
+// than one peer serving filters, a single match is enough to fetch the
+// block. Without any filter the block is fetched anyway. The block is
+// checked against its header.
+func (lc *LightClient) fetchMatchingBlock(hash []byte, entries [][]byte) *Block {
+	header, _, _ := lc.headers.GetHeader(hash)
+
+	matched := false
+	noMatch := 0
+	for _, peer := range lc.peers {
+		data, err := peer.GetFilter(hash)
+		if err != nil {
+			continue
+		}
+
+		filter, err := DeserializeBlockFilter(data)
+		if err != nil {
+			continue
+		}
+
+		if MatchBlockFilter(filter, hash, entries) {
+			matched = true
+			break
+		}
+		noMatch++
+	}
+
+	if !matched && noMatch > 0 {
+		return nil
+	}
+
+	for _, peer := range lc.peers {
+		block, err := peer.GetBlock(hash)
+		if err == nil && checkBlockMatchesHeader(block, hash, &header) == nil {
+			return block
+		}
+		fmt.Printf("peer %s sent a bad block %x\n", peer.Name(), hash)
+	}
+
+	return nil
+}
+
+func (lc *LightClient) GetBalance(address string) (Amount, error) {
+	return SumUTXOs(lc.FindUTXO(address))
+}
+
+// Send signs the transaction with the outputs from the proofs, so no chain
+// is needed, and hands it to every peer.
+func (lc *LightClient) Send(from, to string, amount Amount) *Transaction {
+	signer, err := Nfc_wallets.GetSigner(from)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	acc, validUtxo := SelectOutputs(lc.FindUTXO(from), amount)
+
+	if acc < amount {
+		fmt.Println("balance isn't enough to pay for this transaction.")
+		os.Exit(1)
+	}
+
+	tx := NewTransactionFromUTXOs(from, to, amount, 0, SequenceFinal, acc, validUtxo)
+
+	prevOuts := []TxOutput{}
+	for _, utxo := range validUtxo {
+		prevOuts = append(prevOuts, utxo.Output)
+	}
+	tx.SignWithPrevOutputs(signer, SigHashAll, prevOuts)
+
+	sent := false
+	for _, peer := range lc.peers {
+		if err := peer.SendTransaction(tx); err != nil {
+			fmt.Printf("peer %s: %s\n", peer.Name(), err)
+			continue
+		}
+		sent = true
+	}
+
+	if !sent {
+		fmt.Println("no peer accepted the transaction.")
+		os.Exit(1)
+	}
+
+	return tx
+}
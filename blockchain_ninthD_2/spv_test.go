@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+import "path/filepath"
+import "github.com/btcsuite/btcutil/gcs"
+
+// spvTestPeer serves filter, when set, for every block in place of the
+// real one and counts the blocks it is asked for.
+type spvTestPeer struct {
+	Peer
+	filter []byte
+	blocks int
+}
+
+func (p *spvTestPeer) GetFilter(hash []byte) ([]byte, error) {
+	if p.filter != nil {
+		return p.filter, nil
+	}
+	return p.Peer.GetFilter(hash)
+}
+
+func (p *spvTestPeer) GetBlock(hash []byte) (*Block, error) {
+	p.blocks++
+	return p.Peer.GetBlock(hash)
+}
+
+func TestFetchMatchingBlock(t *testing.T) {
+	peerDir := t.TempDir()
+	t.Chdir(peerDir)
+
+	bc := NewBlockChain()
+	coinbase := &Transaction{[]byte{}, []TxInput{}, []TxOutput{{BlockReward, mempoolTestPubKeyHash}}}
+	coinbase.SetID()
+	bc.AddBlock([]*Transaction{coinbase})
+	bc.Close()
+
+	t.Chdir(t.TempDir())
+
+	filePeer, err := NewFilePeer(filepath.Join(peerDir, "NFC_chain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filePeer.Close()
+
+	lying, err := gcs.BuildGCSFilter(filterP, filterM, [gcs.KeySize]byte{}, [][]byte{{0x42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lie, err := lying.NBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		filters [][]byte
+		fetched bool
+	}{
+		{"one honest peer", [][]byte{nil}, true},
+		{"one lying peer", [][]byte{lie}, false},
+		{"lying and honest peers", [][]byte{lie, nil}, true},
+		{"two lying peers", [][]byte{lie, lie}, false},
+	}
+
+	for i, test := range tests {
+		peers := []Peer{}
+		testPeers := []*spvTestPeer{}
+		for _, filter := range test.filters {
+			peer := &spvTestPeer{filePeer, filter, 0}
+			peers = append(peers, peer)
+			testPeers = append(testPeers, peer)
+		}
+
+		lc := NewLightClient(filepath.Join(t.TempDir(), "NFC_spv"), peers)
+		lc.SyncHeaders()
+
+		block := lc.fetchMatchingBlock(lc.headers.BestHeader(), [][]byte{mempoolTestPubKeyHash})
+		lc.Close()
+
+		if (block != nil) != test.fetched {
+			t.Errorf("%d %s: fetched %v, want %v", i, test.name, block != nil, test.fetched)
+		}
+		if !test.fetched && testPeers[0].blocks != 0 {
+			t.Errorf("%d %s: the block was downloaded", i, test.name)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import "fmt"
+import "bytes"
+import "errors"
+import "sync"
+import "sync/atomic"
+import "github.com/boltdb/bolt"
+
+const maxHeadersPerRequest = 2000
+
+// concurrent body downloads per peer
+const downloadsPerPeer = 4
+
+var errBodyMismatch = errors.New("block body doesn't match its header")
+
+// SyncManager downloads the chain headers first: the header chain is
+// fetched and validated on its own, then the missing block bodies are
+// fetched from all peers in parallel and connected in order.
+type SyncManager struct {
+	bc    *BlockChain
+	peers []Peer
+}
+
+func NewSyncManager(bc *BlockChain, peers []Peer) *SyncManager {
+	return &SyncManager{bc, peers}
+}
+
+func (sm *SyncManager) Sync() error {
+	SyncHeaders(sm.bc.Headers(), sm.peers)
+
+	return sm.syncBlocks()
+}
+
+// SyncHeaders extends store with the validated headers of every peer.
+func SyncHeaders(store *HeaderStore, peers []Peer) {
+	for _, peer := range peers {
+		for {
+			headers, err := peer.GetHeaders(store.BlockLocator(), maxHeadersPerRequest)
+			if err != nil {
+				fmt.Printf("peer %s: %s\n", peer.Name(), err)
+				break
+			}
+
+			if len(headers) == 0 {
+				break
+			}
+
+			if err := store.AddHeaders(headers); err != nil {
+				fmt.Printf("peer %s sent an invalid header: %s\n", peer.Name(), err)
+				break
+			}
+
+			if len(headers) < maxHeadersPerRequest {
+				break
+			}
+		}
+	}
+
+	_, height, _ := store.GetHeader(store.BestHeader())
+	fmt.Printf("best header height %d\n", height)
+}
+
+func (sm *SyncManager) syncBlocks() error {
+	missing, err := sm.bc.MissingBlocks()
+	if err != nil {
+		return err
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	blocks := make([]*Block, len(missing))
+	attempts := make([]int32, len(missing))
+	maxAttempts := int32(2 * len(sm.peers))
+
+	jobs := make(chan int, len(missing))
+	for i := range missing {
+		jobs <- i
+	}
+
+	var remaining sync.WaitGroup
+	remaining.Add(len(missing))
+
+	for _, peer := range sm.peers {
+		for i := 0; i < downloadsPerPeer; i++ {
+			go func(peer Peer) {
+				for i := range jobs {
+					block, err := peer.GetBlock(missing[i])
+					if err == nil {
+						err = sm.checkBody(missing[i], block)
+					}
+
+					if err == nil {
+						blocks[i] = block
+					} else if atomic.AddInt32(&attempts[i], 1) < maxAttempts {
+						// give another peer a go
+						jobs <- i
+						continue
+					}
+					remaining.Done()
+				}
+			}(peer)
+		}
+	}
+
+	remaining.Wait()
+	close(jobs)
+
+	for i, block := range blocks {
+		if block == nil {
+			return fmt.Errorf("couldn't download block %x", missing[i])
+		}
+
+		if err := sm.bc.ConnectBlock(block); err != nil {
+			return fmt.Errorf("block %x: %s", missing[i], err)
+		}
+	}
+
+	fmt.Printf("downloaded %d blocks, height %d\n", len(blocks), sm.bc.Height())
+	return nil
+}
+
+func (sm *SyncManager) checkBody(hash []byte, block *Block) error {
+	header, _, _ := sm.bc.Headers().GetHeader(hash)
+
+	if bytes.Compare(block.Hash, hash) != 0 {
+		return errBodyMismatch
+	}
+
+	return checkBlockMatchesHeader(block, hash, &header)
+}
+
+// checkBlockMatchesHeader makes sure a block served by a peer is the one
+// its header commits to.
+func checkBlockMatchesHeader(block *Block, hash []byte, header *BlockHeader) error {
+	if bytes.Compare(block.Header.Hash(), hash) != 0 {
+		return errBodyMismatch
+	}
+
+	if bytes.Compare(MerkleRoot(block.Transactions), header.MerkleRoot[:]) != 0 {
+		return errBodyMismatch
+	}
+
+	return nil
+}
+
+// ConnectBlock appends a downloaded block whose header is already in the
+// header tree to the tip of the chain.
+func (bc *BlockChain) ConnectBlock(block *Block) error {
+	if bytes.Compare(block.Header.PrevBlockHash[:], bc.tip) != 0 {
+		return errNotOnTip
+	}
+
+	if err := CheckBlock(block); err != nil {
+		return err
+	}
+
+	if err := bc.CheckNewTransactions(block.Transactions); err != nil {
+		return err
+	}
+
+	prevOuts, err := CheckInputsUnspent(block.Transactions, bc.UnspentOutputs())
+	if err != nil {
+		return err
+	}
+
+	if err := CheckCoinbaseValue(block.Transactions, prevOuts); err != nil {
+		return err
+	}
+
+	failures := VerifyTransactionsWithPrevOutputs(block.Transactions, prevOuts)
+	if len(failures) > 0 {
+		return failures[0]
+	}
+
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+
+		if err := b.Put(block.Hash, block.SerializeBlock()); err != nil {
+			return err
+		}
+
+		if err := b.Put([]byte("l"), block.Hash); err != nil {
+			return err
+		}
+
+		bc.tip = block.Hash
+		return putBlockFilter(tx, block)
+	})
+}
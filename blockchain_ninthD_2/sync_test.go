@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+import "bytes"
+import "path/filepath"
+
+func TestSyncFreshNode(t *testing.T) {
+	peerDir := t.TempDir()
+	t.Chdir(peerDir)
+
+	peerChain := NewBlockChain()
+	for i := 0; i < 3; i++ {
+		coinbase := &Transaction{[]byte{}, []TxInput{}, []TxOutput{{BlockReward, mempoolTestPubKeyHash}}}
+		coinbase.SetID()
+		peerChain.AddBlock([]*Transaction{coinbase})
+	}
+	peerTip := peerChain.tip
+	peerChain.Close()
+
+	t.Chdir(t.TempDir())
+
+	bc := NewBlockChain()
+	t.Cleanup(func() { bc.db.Close() })
+
+	peer, err := NewFilePeer(filepath.Join(peerDir, "NFC_chain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	if err := NewSyncManager(bc, []Peer{peer}).Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(bc.tip, peerTip) {
+		t.Errorf("tip %x, want the peer's %x", bc.tip, peerTip)
+	}
+	if bc.Height() != 3 {
+		t.Errorf("height %d, want 3", bc.Height())
+	}
+}
+
+func TestConnectBlock(t *testing.T) {
+	bc, _, funding := mempoolTestChain(t, mempoolTestPubKeyHash, 10)
+
+	coinbase := func(value Amount) *Transaction {
+		tx := &Transaction{[]byte{}, []TxInput{}, []TxOutput{{value, mempoolTestPubKeyHash}}}
+		tx.SetID()
+		return tx
+	}
+
+	tests := []struct {
+		name string
+		txs  []*Transaction
+		want RuleCode
+	}{
+		{"double spend", []*Transaction{coinbase(BlockReward), spendTestTx(funding, 0, SequenceFinal, 9), spendTestTx(funding, 0, SequenceFinal, 8)}, RuleMissingInput},
+		{"missing output", []*Transaction{coinbase(BlockReward), spendTestTx(funding, 1, SequenceFinal, 9)}, RuleMissingInput},
+		{"overpaid coinbase", []*Transaction{coinbase(BlockReward + 1)}, RuleCoinbaseValue},
+		{"coinbase above fees", []*Transaction{coinbase(BlockReward + 2), spendTestTx(funding, 0, SequenceFinal, 9)}, RuleCoinbaseValue},
+	}
+
+	for _, test := range tests {
+		tip := bc.tip
+		err := bc.ConnectBlock(NewBlock(test.txs, bc.tip))
+		if ruleCode(err) != test.want {
+			t.Errorf("%s: got %v, want rule %d", test.name, err, test.want)
+		}
+		if !bytes.Equal(bc.tip, tip) {
+			t.Fatalf("%s: the tip moved", test.name)
+		}
+	}
+
+	block := NewBlock([]*Transaction{coinbase(BlockReward)}, bc.tip)
+	if err := bc.ConnectBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bc.tip, block.Hash) {
+		t.Errorf("tip %x, want %x", bc.tip, block.Hash)
+	}
+}
@@ -3,13 +3,9 @@ package main
 import "fmt"
 import "os"
 import "bytes"
-import "strconv"
 import "encoding/hex"
-import "crypto/ecdsa"
+import "encoding/gob"
 import "crypto/sha256"
-import "crypto/rand"
-import "math/big"
-import "crypto/elliptic"
 
 type Transaction struct {
 	ID   []byte
@@ -23,12 +19,15 @@ type UTXO struct {
 	Output TxOutput
 }
 
+// what a coinbase pays, the fees of the block aside
+const BlockReward = 20 * Coin
+
 func NewCoinbaseTx(to, data string) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
 
-	txout := TxOutput{20, GetPubKeyHashFromAddr(to)}
+	txout := TxOutput{BlockReward, AddressPubKeyHash(to)}
 
 	tx := &Transaction{[]byte{}, []TxInput{}, []TxOutput{txout}}
 
@@ -37,72 +36,184 @@ func NewCoinbaseTx(to, data string) *Transaction {
 	return tx
 }
 
+func (tx *Transaction) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(tx)
+
+	return result.Bytes()
+}
+
+func DeserializeTransaction(buffer []byte) *Transaction {
+	var tx Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(buffer))
+
+	_ = decoder.Decode(&tx)
+
+	return &tx
+}
+
+// Hash commits to the whole transaction, unlike ID which is random, so it
+// is what the block merkle root is built from.
+func (tx *Transaction) Hash() []byte {
+	first := sha256.Sum256(tx.encode())
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
+
+// Size is the length of the encoding Hash is computed over, what the
+// transaction counts for against MaxBlockSize.
+func (tx *Transaction) Size() int {
+	return len(tx.encode())
+}
+
+func (tx *Transaction) encode() []byte {
+	var buf bytes.Buffer
+
+	writeVarBytes(&buf, tx.ID)
+
+	writeUint32(&buf, uint32(len(tx.Vin)))
+	for _, in := range tx.Vin {
+		writeVarBytes(&buf, in.Txid)
+		writeUint32(&buf, uint32(in.Vout))
+		writeVarBytes(&buf, in.Signature)
+		writeVarBytes(&buf, in.PublicKey)
+	}
+
+	writeUint32(&buf, uint32(len(tx.Vout)))
+	for _, out := range tx.Vout {
+		writeUint64(&buf, uint64(out.Value))
+		writeVarBytes(&buf, out.PubKeyHash)
+	}
+
+	writeSequences(&buf, tx.Vin)
+
+	return buf.Bytes()
+}
+
+// writeSequences writes the sequence of every input after the rest of the
+// encoding, only when one of them isn't final. Transactions made before
+// sequences keep their encoding, and the encoding before is self
+// delimiting so the two can't be mixed up.
+func writeSequences(buf *bytes.Buffer, inputs []TxInput) {
+	final := true
+	for _, in := range inputs {
+		if in.GetSequence() != SequenceFinal {
+			final = false
+		}
+	}
+	if final {
+		return
+	}
+
+	for _, in := range inputs {
+		writeUint32(buf, in.GetSequence())
+	}
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 0
 }
 
-func NewUTXOTransaction(from, to string, amount int, bc *BlockChain, utxoset *UTXOSet) *Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
+// SignalsReplacement tells whether tx opted in to replace-by-fee.
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.Vin {
+		if in.GetSequence() <= MaxRBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+func NewUTXOTransaction(from, to string, amount, fee Amount, sequence uint32, selector CoinSelector, bc *BlockChain, utxoset *UTXOSet, mempool *Mempool) *Transaction {
+	signer, err := Nfc_wallets.GetSigner(from)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+
+	total, err := amount.Add(fee)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
 
-	acc, validUtxo := FindEnoughOutputs(from, amount, utxoset)
+	acc, validUtxo := FindEnoughOutputs(from, total, selector, utxoset, mempool)
 
-	if acc < amount {
+	if acc < total {
 		fmt.Println("balance isn't enough to pay for this transaction.")
 		os.Exit(1)
 	}
 
+	tx := NewTransactionFromUTXOs(from, to, amount, fee, sequence, acc, validUtxo)
+	tx.SetSignature(signer, bc)
+
+	return tx
+}
+
+// NewTransactionFromUTXOs builds the unsigned transaction paying amount to
+// to and fee to the miner out of validUtxo, worth acc in total, with the
+// change back to from. Every input gets sequence, MaxRBFSequence signals
+// replace-by-fee, see bumpfee.
+func NewTransactionFromUTXOs(from, to string, amount, fee Amount, sequence uint32, acc Amount, validUtxo []UTXO) *Transaction {
+	var inputs []TxInput
+	var outputs []TxOutput
+
 	for _, utxo := range validUtxo {
 		txid, _ := hex.DecodeString(utxo.TxStr)
 
-		txin := TxInput{txid, utxo.OutInd, []byte{}, Nfc_wallets.GetPubKeyFromAddr(from)}
+		txin := TxInput{txid, utxo.OutInd, []byte{}, Nfc_wallets.GetPubKeyFromAddr(from), sequence}
 		inputs = append(inputs, txin)
 	}
 
-	outputs = append(outputs, TxOutput{amount, GetPubKeyHashFromAddr(to)})
-	if acc > amount {
-		outputs = append(outputs, TxOutput{acc - amount, GetPubKeyHashFromAddr(from)})
+	outputs = append(outputs, TxOutput{amount, AddressPubKeyHash(to)})
+	if acc > amount+fee {
+		outputs = append(outputs, TxOutput{acc - amount - fee, AddressPubKeyHash(from)})
 	}
 
 	tx := &Transaction{[]byte{}, inputs, outputs}
 	tx.SetID()
-	tx.SetSignature(Nfc_wallets.Wallets[from].PrivateKey, bc)
 
 	return tx
 }
 
-func (tx *Transaction) SetSignature(privatekey ecdsa.PrivateKey, bc *BlockChain) {
+func (tx *Transaction) SetSignature(signer Signer, bc *BlockChain) {
+	tx.SetSignatureWithType(signer, SigHashAll, bc)
+}
+
+func (tx *Transaction) SetSignatureWithType(signer Signer, hashType byte, bc *BlockChain) {
 	if tx.IsCoinbase() {
 		return
 	}
 
-	prevTx := tx.getPreviousTx(bc)
-
-	for inInd, in := range tx.Vin {
-		contentToSign := []byte{}
-
-		// add the prev output info to the content to be signed
-		contentToSign = bytes.Join([][]byte{in.Txid, []byte(strconv.Itoa(in.Vout))}, []byte{})
+	prevOuts, ok := tx.getPreviousOutputs(bc)
+	if !ok {
+		fmt.Println("can't find the previous outputs of this transaction.")
+		os.Exit(1)
+	}
 
-		// add the hash of the publickey of the sender to the content to be signed
-		contentToSign = bytes.Join([][]byte{contentToSign, prevTx[hex.EncodeToString(in.Txid)].Vout[in.Vout].PubKeyHash}, []byte{})
+	tx.SignWithPrevOutputs(signer, hashType, prevOuts)
+}
 
-		for _, out := range tx.Vout {
-			// add the outputs info to the content to be signed
-			contentToSign = bytes.Join([][]byte{contentToSign, out.PubKeyHash, []byte(strconv.Itoa(out.Value))}, []byte{})
+func (tx *Transaction) SignWithPrevOutputs(signer Signer, hashType byte, prevOuts []TxOutput) {
+	for inInd := range tx.Vin {
+		hashToSign, err := tx.SigHash(inInd, hashType, prevOuts)
+		if err != nil {
+			fmt.Println("Error is ", err)
+			os.Exit(-1)
 		}
 
-		hashToSign := sha256.Sum256(contentToSign)
-
-		r, s, err := ecdsa.Sign(rand.Reader, &privatekey, hashToSign[:])
+		signature, err := signer.Sign(hashToSign)
 		if err != nil {
 			fmt.Println("Error is ", err)
 			os.Exit(-1)
 		}
 
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Vin[inInd].Signature = signature
-
+		tx.Vin[inInd].Signature = append(signature, hashType)
 	}
 }
 
@@ -122,7 +233,7 @@ func (tx *Transaction) getPreviousTx(bc *BlockChain) map[string]Transaction {
 			}
 		}
 
-		if len(block.PreBlockHash) == 0 {
+		if len(bci.currentHash) == 0 {
 			break
 		}
 	}
@@ -130,39 +241,65 @@ func (tx *Transaction) getPreviousTx(bc *BlockChain) map[string]Transaction {
 	return prevTx
 }
 
-func (tx *Transaction) Verify(bc *BlockChain) bool {
-	if tx.IsCoinbase() {
-		return true
-	}
-
-	curve := elliptic.P256()
+// getPreviousOutputs returns the outputs spent by tx.Vin, in input order.
+func (tx *Transaction) getPreviousOutputs(bc *BlockChain) ([]TxOutput, bool) {
 	prevTx := tx.getPreviousTx(bc)
 
+	prevOuts := []TxOutput{}
 	for _, in := range tx.Vin {
-		contentToVerify := []byte{}
-		contentToVerify = bytes.Join([][]byte{in.Txid, []byte(strconv.Itoa(in.Vout)), prevTx[hex.EncodeToString(in.Txid)].Vout[in.Vout].PubKeyHash}, []byte{})
-		for _, out := range tx.Vout {
-			contentToVerify = bytes.Join([][]byte{contentToVerify, out.PubKeyHash, []byte(strconv.Itoa(out.Value))}, []byte{})
+		prev, ok := prevTx[hex.EncodeToString(in.Txid)]
+		if !ok || in.Vout < 0 || in.Vout >= len(prev.Vout) {
+			return nil, false
 		}
+		prevOuts = append(prevOuts, prev.Vout[in.Vout])
+	}
 
-		hashToVerify := sha256.Sum256(contentToVerify)
+	return prevOuts, true
+}
 
-		r := big.Int{}
-		s := big.Int{}
-		signLen := len(in.Signature)
-		r.SetBytes(in.Signature[:signLen/2])
-		s.SetBytes(in.Signature[signLen/2:])
+func (tx *Transaction) Verify(bc *BlockChain) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+
+	prevOuts, ok := tx.getPreviousOutputs(bc)
+	if !ok {
+		return false
+	}
 
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(in.PublicKey)
-		x.SetBytes(in.PublicKey[:keyLen/2])
-		y.SetBytes(in.PublicKey[keyLen/2:])
+	return tx.VerifyWithPrevOutputs(prevOuts)
+}
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, hashToVerify[:], &r, &s) == false {
+func (tx *Transaction) VerifyWithPrevOutputs(prevOuts []TxOutput) bool {
+	for inInd := range tx.Vin {
+		if tx.verifyInput(inInd, prevOuts) != nil {
 			return false
 		}
 	}
 	return true
 }
+
+func (tx *Transaction) verifyInput(inInd int, prevOuts []TxOutput) error {
+	in := tx.Vin[inInd]
+
+	// the last byte of the signature is the sighash type
+	signLen := len(in.Signature) - 1
+	if signLen <= 0 {
+		return errMissingSignature
+	}
+	hashType := in.Signature[signLen]
+
+	if bytes.Compare(HashPubKey(in.PublicKey), prevOuts[inInd].PubKeyHash) != 0 {
+		return errPubKeyMismatch
+	}
+
+	hashToVerify, err := tx.SigHash(inInd, hashType, prevOuts)
+	if err != nil {
+		return err
+	}
+
+	if VerifySignature(in.PublicKey, hashToVerify, in.Signature[:signLen]) == false {
+		return errBadSignature
+	}
+	return nil
+}
@@ -4,18 +4,36 @@ import "bytes"
 
 // import "fmt"
 
+// an input with a sequence up to MaxRBFSequence lets its transaction be
+// replaced in the mempool by one paying a higher fee, see BIP 125
+const (
+	SequenceFinal  uint32 = 0xffffffff
+	MaxRBFSequence uint32 = 0xfffffffd
+)
+
 type TxInput struct {
 	Txid      []byte
 	Vout      int
 	Signature []byte
 	PublicKey []byte
+	Sequence  uint32
 	// ScriptSig string
 }
 
+// GetSequence returns the sequence of in. A Sequence of 0 is unset, the
+// inputs of transactions made before sequences decode with it, and counts
+// as SequenceFinal.
+func (in *TxInput) GetSequence() uint32 {
+	if in.Sequence == 0 {
+		return SequenceFinal
+	}
+	return in.Sequence
+}
+
 func (in *TxInput) CanUnlockOutputWith(address string) bool {
 
 	// return bytes.Compare(Nfc_wallets.Wallets[address].PublicKey, in.PublicKey) == 0
-	pubKeyHash := GetPubKeyHashFromAddr(address)
+	pubKeyHash := AddressPubKeyHash(address)
 	return bytes.Compare(pubKeyHash, HashPubKey(in.PublicKey)) == 0
 	// return in.ScriptSig == unlockingData
 }
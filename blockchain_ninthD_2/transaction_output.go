@@ -3,7 +3,7 @@ package main
 import "bytes"
 
 type TxOutput struct {
-	Value      int
+	Value      Amount
 	PubKeyHash []byte
 	// ScriptPubKey string
 }
@@ -11,7 +11,7 @@ type TxOutput struct {
 func (out *TxOutput) CanBeUnlockedWith(address string) bool {
 	// return out.ScriptPubKey == unlockingData
 
-	pubKeyHash := GetPubKeyHashFromAddr(address)
+	pubKeyHash := AddressPubKeyHash(address)
 
 	return bytes.Compare(pubKeyHash, out.PubKeyHash) == 0
 }
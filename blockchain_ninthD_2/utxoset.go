@@ -31,7 +31,10 @@ func (bc *BlockChain) GetUTXOSet() map[string][]UTXO {
 
 		txs := block.Transactions
 
-		for _, tx := range txs {
+		// newest first within the block too, a child spending its parent's
+		// output comes after the parent
+		for txInd := len(txs) - 1; txInd >= 0; txInd-- {
+			tx := txs[txInd]
 			txstr := hex.EncodeToString(tx.ID)
 
 			if tx.IsCoinbase() == false {
@@ -64,6 +67,19 @@ func (bc *BlockChain) GetUTXOSet() map[string][]UTXO {
 	return utxoSet
 }
 
+// UnspentOutputs returns the unspent outputs of the chain by outpoint.
+func (bc *BlockChain) UnspentOutputs() map[string]TxOutput {
+	unspent := make(map[string]TxOutput)
+
+	for _, utxos := range bc.GetUTXOSet() {
+		for _, utxo := range utxos {
+			unspent[utxoKey(utxo)] = utxo.Output
+		}
+	}
+
+	return unspent
+}
+
 func SerializeUTXOS(utxos []UTXO) []byte {
 	var result bytes.Buffer
 
@@ -0,0 +1,150 @@
+package main
+
+import "fmt"
+import "sort"
+import "sync"
+import "errors"
+import "runtime"
+import "strconv"
+import "encoding/hex"
+
+var errMissingSignature = errors.New("missing signature")
+var errPubKeyMismatch = errors.New("public key doesn't match the previous output")
+var errBadSignature = errors.New("invalid signature")
+var errMissingPrevOutput = errors.New("previous output not found")
+
+// InputVerifyError reports why one input of a transaction failed to verify.
+type InputVerifyError struct {
+	TxStr string
+	InInd int
+	Err   error
+}
+
+func (e InputVerifyError) Error() string {
+	return fmt.Sprintf("transaction %s input %d: %s", e.TxStr, e.InInd, e.Err)
+}
+
+func outpointKey(txid []byte, vout int) string {
+	return hex.EncodeToString(txid) + ":" + strconv.Itoa(vout)
+}
+
+// FindPreviousOutputs collects the outputs spent by txs with a single pass
+// over the chain. Outputs created by txs themselves are included too, so a
+// block may spend an output created earlier in the same block.
+func (bc *BlockChain) FindPreviousOutputs(txs []*Transaction) map[string]TxOutput {
+	prevOuts := make(map[string]TxOutput)
+	wanted := make(map[string]bool)
+
+	for _, tx := range txs {
+		for _, in := range tx.Vin {
+			wanted[hex.EncodeToString(in.Txid)] = true
+		}
+	}
+
+	collect := func(tx *Transaction) {
+		txstr := hex.EncodeToString(tx.ID)
+		if !wanted[txstr] {
+			return
+		}
+		for outInd, out := range tx.Vout {
+			prevOuts[outpointKey(tx.ID, outInd)] = out
+		}
+		delete(wanted, txstr)
+	}
+
+	for _, tx := range txs {
+		collect(tx)
+	}
+
+	bci := NewBlockchainIterator(bc)
+	for len(wanted) > 0 {
+		block := bci.Next()
+
+		for _, blockTx := range block.Transactions {
+			collect(blockTx)
+		}
+
+		if len(bci.currentHash) == 0 {
+			break
+		}
+	}
+
+	return prevOuts
+}
+
+// VerifyTransactions checks every input signature of txs, spreading the
+// work over GOMAXPROCS goroutines. It returns one error per failed input,
+// in the order of txs and their inputs.
+func (bc *BlockChain) VerifyTransactions(txs []*Transaction) []InputVerifyError {
+	return VerifyTransactionsWithPrevOutputs(txs, bc.FindPreviousOutputs(txs))
+}
+
+func VerifyTransactionsWithPrevOutputs(txs []*Transaction, prevOuts map[string]TxOutput) []InputVerifyError {
+	type job struct {
+		tx       *Transaction
+		inInd    int
+		prevOuts []TxOutput
+	}
+
+	failures := []InputVerifyError{}
+	jobs := []job{}
+
+Txs:
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		txPrevOuts := []TxOutput{}
+		for inInd, in := range tx.Vin {
+			out, ok := prevOuts[outpointKey(in.Txid, in.Vout)]
+			if !ok {
+				failures = append(failures, InputVerifyError{hex.EncodeToString(tx.ID), inInd, errMissingPrevOutput})
+				continue Txs
+			}
+			txPrevOuts = append(txPrevOuts, out)
+		}
+
+		for inInd := range tx.Vin {
+			jobs = append(jobs, job{tx, inInd, txPrevOuts})
+		}
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	jobCh := make(chan job)
+
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				if err := j.tx.verifyInput(j.inInd, j.prevOuts); err != nil {
+					mutex.Lock()
+					failures = append(failures, InputVerifyError{hex.EncodeToString(j.tx.ID), j.inInd, err})
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, j := range jobs {
+		jobCh <- j
+	}
+	close(jobCh)
+	wg.Wait()
+
+	// the goroutines report in any order
+	txOrder := make(map[string]int)
+	for txInd, tx := range txs {
+		txOrder[hex.EncodeToString(tx.ID)] = txInd
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].TxStr != failures[j].TxStr {
+			return txOrder[failures[i].TxStr] < txOrder[failures[j].TxStr]
+		}
+		return failures[i].InInd < failures[j].InInd
+	})
+
+	return failures
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+import "encoding/hex"
+
+// verifyTestBlock returns txCount signed transactions of inCount inputs
+// each, spending the outputs of one previous transaction, and the outputs
+// they spend.
+func verifyTestBlock(tb testing.TB, txCount, inCount int) ([]*Transaction, map[string]TxOutput) {
+	w := NewWallet()
+	signer, err := w.Signer()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	prevTx := &Transaction{[]byte{0xff}, []TxInput{}, []TxOutput{}}
+	for i := 0; i < txCount*inCount; i++ {
+		prevTx.Vout = append(prevTx.Vout, TxOutput{Coin, HashPubKey(w.PublicKey)})
+	}
+
+	prevOuts := make(map[string]TxOutput)
+	for outInd, out := range prevTx.Vout {
+		prevOuts[outpointKey(prevTx.ID, outInd)] = out
+	}
+
+	txs := []*Transaction{}
+	for txInd := 0; txInd < txCount; txInd++ {
+		tx := &Transaction{[]byte{byte(txInd >> 8), byte(txInd)}, []TxInput{}, []TxOutput{{Amount(inCount) * Coin, []byte{0x11}}}}
+		txPrevOuts := []TxOutput{}
+		for i := 0; i < inCount; i++ {
+			vout := txInd*inCount + i
+			tx.Vin = append(tx.Vin, TxInput{prevTx.ID, vout, []byte{}, w.PublicKey, SequenceFinal})
+			txPrevOuts = append(txPrevOuts, prevTx.Vout[vout])
+		}
+		tx.SignWithPrevOutputs(signer, SigHashAll, txPrevOuts)
+		txs = append(txs, tx)
+	}
+
+	return txs, prevOuts
+}
+
+func TestVerifyFailuresOrder(t *testing.T) {
+	txs, prevOuts := verifyTestBlock(t, 4, 50)
+
+	broken := [][2]int{{0, 3}, {0, 41}, {2, 0}, {3, 7}, {3, 49}}
+	for _, b := range broken {
+		txs[b[0]].Vin[b[1]].Signature[0] ^= 1
+	}
+
+	for run := 0; run < 5; run++ {
+		failures := VerifyTransactionsWithPrevOutputs(txs, prevOuts)
+		if len(failures) != len(broken) {
+			t.Fatalf("%d failures, want %d: %v", len(failures), len(broken), failures)
+		}
+
+		for i, b := range broken {
+			if failures[i].InInd != b[1] || failures[i].TxStr != hex.EncodeToString(txs[b[0]].ID) {
+				t.Fatalf("failure %d is %v, want transaction %d input %d", i, failures[i], b[0], b[1])
+			}
+		}
+	}
+}
+
+func benchmarkVerify(b *testing.B, verify func([]*Transaction, map[string]TxOutput) int) {
+	txs, prevOuts := verifyTestBlock(b, 40, 100)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if failed := verify(txs, prevOuts); failed > 0 {
+			b.Fatalf("%d inputs failed", failed)
+		}
+	}
+}
+
+// BenchmarkVerifySerial checks the 4000 inputs one after the other, like
+// blocks were checked before VerifyTransactions.
+func BenchmarkVerifySerial(b *testing.B) {
+	benchmarkVerify(b, func(txs []*Transaction, prevOuts map[string]TxOutput) int {
+		failed := 0
+		for _, tx := range txs {
+			txPrevOuts := []TxOutput{}
+			for _, in := range tx.Vin {
+				txPrevOuts = append(txPrevOuts, prevOuts[outpointKey(in.Txid, in.Vout)])
+			}
+			if !tx.VerifyWithPrevOutputs(txPrevOuts) {
+				failed++
+			}
+		}
+		return failed
+	})
+}
+
+func BenchmarkVerifyParallel(b *testing.B) {
+	benchmarkVerify(b, func(txs []*Transaction, prevOuts map[string]TxOutput) int {
+		return len(VerifyTransactionsWithPrevOutputs(txs, prevOuts))
+	})
+}
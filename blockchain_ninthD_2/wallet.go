@@ -3,54 +3,174 @@ package main
 import "bytes"
 import "crypto/sha256"
 import "golang.org/x/crypto/ripemd160"
-import "crypto/ecdsa"
-import "crypto/elliptic"
 import "encoding/gob"
-import "crypto/rand"
+import "strings"
 import "github.com/btcsuite/btcutil/base58"
 import "crypto/x509"
 import "encoding/pem"
 
 import "fmt"
 import "os"
+import "errors"
 
+var errInvalidPrivateKey = errors.New("invalid encoded private key")
+
+// PrivateKey is nil while the wallet is encrypted and locked, EncryptedKey
+// is nil while it isn't encrypted.
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
-	PublicKey  []byte
+	PrivateKey   []byte
+	PublicKey    []byte
+	EncryptedKey []byte
 }
 
 type SerializableWallet struct {
 	PrivateKeyStr string
 	PublicKey     []byte
+	EncryptedKey  []byte
 }
 
 func NewWallet() *Wallet {
-	privateKey, publicKey := newKeyPair()
-	wallet := &Wallet{privateKey, publicKey}
+	return NewWalletWithScheme(VersionP256)
+}
+
+func NewWalletWithScheme(version byte) *Wallet {
+	privateKey, publicKey := newKeyPair(version)
+	wallet := &Wallet{privateKey, publicKey, nil}
 
 	return wallet
 }
 
-func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()
-	private, _ := ecdsa.GenerateKey(curve, rand.Reader)
-	public := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+func newKeyPair(version byte) ([]byte, []byte) {
+	scheme, err := GetSignatureScheme(version)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(-1)
+	}
+
+	private, err := scheme.GenerateKey()
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(-1)
+	}
+
+	signer, _ := scheme.NewSigner(private)
+
+	return private, signer.PublicKey()
+}
+
+func (w Wallet) Signer() (Signer, error) {
+	if w.PrivateKey == nil {
+		return nil, errWalletLocked
+	}
+
+	return NewKeySigner(w.PublicKey, w.PrivateKey)
+}
 
-	return *private, public
+// Version is the version byte of the scheme of the wallet's key,
+// VersionLegacyP256 for a legacy key.
+func (w Wallet) Version() byte {
+	if IsLegacyKey(w.PublicKey) {
+		return VersionLegacyP256
+	}
+	return w.PublicKey[0]
+}
+
+// Encrypt seals the private key, it stays usable until Lock.
+func (wallet *Wallet) Encrypt(crypter *WalletCrypter) error {
+	encrypted, err := crypter.Seal(wallet.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	wallet.EncryptedKey = encrypted
+
+	return nil
+}
+
+func (wallet *Wallet) Decrypt(crypter *WalletCrypter) error {
+	privateKey, err := crypter.Open(wallet.EncryptedKey)
+	if err != nil {
+		return err
+	}
+
+	wallet.PrivateKey = privateKey
+
+	return nil
+}
+
+// Lock forgets the private key of an encrypted wallet.
+func (wallet *Wallet) Lock() {
+	if wallet.EncryptedKey == nil {
+		return
+	}
+
+	for i := range wallet.PrivateKey {
+		wallet.PrivateKey[i] = 0
+	}
+	wallet.PrivateKey = nil
 }
 
+// GetAddress returns the bech32 address of the wallet on the active network.
 func (w Wallet) GetAddress() string {
-	pubKeyHash := HashPubKey(w.PublicKey)
+	return NewPubKeyHashAddress(HashPubKey(w.PublicKey)).String()
+}
+
+// GetLegacyAddress returns the base58 address used before bech32, its
+// version byte is the signature scheme. Legacy keys had VersionP256.
+func (w Wallet) GetLegacyAddress() string {
+	if IsLegacyKey(w.PublicKey) {
+		return encodeLegacyAddress(VersionP256, HashPubKey(w.PublicKey))
+	}
+	return encodeLegacyAddress(w.PublicKey[0], HashPubKey(w.PublicKey))
+}
+
+// ExportPrivateKey encodes the private key the way addresses are: the
+// scheme version, the key and a checksum, in base58.
+func (w Wallet) ExportPrivateKey() (string, error) {
+	if w.PrivateKey == nil {
+		return "", errWalletLocked
+	}
+
+	payload := append([]byte{w.Version()}, w.PrivateKey...)
+
+	return base58.Encode(append(payload, checksum(payload)...)), nil
+}
 
-	versionedPayload := append([]byte("1"), pubKeyHash...)
-	checksum := checksum(versionedPayload)
+// ImportPrivateKey decodes a key written by ExportPrivateKey.
+func ImportPrivateKey(encoded string) (*Wallet, error) {
+	decoded := base58.Decode(encoded)
+	if len(decoded) < 6 {
+		return nil, errInvalidPrivateKey
+	}
+
+	payload := decoded[:len(decoded)-4]
+	if !bytes.Equal(checksum(payload), decoded[len(decoded)-4:]) {
+		return nil, errInvalidPrivateKey
+	}
+
+	if payload[0] == VersionLegacyP256 {
+		signer, err := p256Scheme{}.NewSigner(payload[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return &Wallet{payload[1:], legacySigner{signer}.PublicKey(), nil}, nil
+	}
+
+	scheme, err := GetSignatureScheme(payload[0])
+	if err != nil {
+		return nil, err
+	}
 
-	fullPayload := append(versionedPayload, checksum...)
+	signer, err := scheme.NewSigner(payload[1:])
+	if err != nil {
+		return nil, err
+	}
 
-	address := base58.Encode(fullPayload)
-	return address
+	return &Wallet{payload[1:], signer.PublicKey(), nil}, nil
 }
 
+// HashPubKey hashes a versioned or a legacy public key, see VersionP256.
 func HashPubKey(pubkey []byte) []byte {
 	pubKeySha256 := sha256.Sum256(pubkey)
 
@@ -68,19 +188,17 @@ func checksum(content []byte) []byte {
 	return secondSha256[:4]
 }
 
-func GetPubKeyHashFromAddr(address string) []byte {
-	decodeAddr := base58.Decode(address)
-
-	pubKeyHash := decodeAddr[1 : len(decodeAddr)-4]
-
-	return pubKeyHash[:]
-}
-
+// SerializeWallet never writes the private key of an encrypted wallet in
+// the clear, even while it is unlocked.
 func (wallet *Wallet) SerializeWallet() []byte {
-	x509Encoded, _ := x509.MarshalECPrivateKey(&wallet.PrivateKey)
-	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
+	serializable := SerializableWallet{"", wallet.PublicKey, wallet.EncryptedKey}
+
+	if wallet.EncryptedKey == nil {
+		scheme, _ := KeyScheme(wallet.PublicKey)
+		pemEncoded := pem.EncodeToMemory(&pem.Block{Type: walletPEMType(scheme), Bytes: wallet.PrivateKey})
+		serializable.PrivateKeyStr = string(pemEncoded)
+	}
 
-	serializable := SerializableWallet{string(pemEncoded), wallet.PublicKey}
 	result := serializable.SerializeHelper()
 
 	return result[:]
@@ -89,19 +207,43 @@ func (wallet *Wallet) SerializeWallet() []byte {
 func DeSerializeWallet(buffer []byte) *Wallet {
 	sWallet := DeSerializeHelper(buffer)
 
+	if sWallet.EncryptedKey != nil {
+		return &Wallet{nil, padWalletKey(sWallet.PublicKey), sWallet.EncryptedKey}
+	}
+
 	block, _ := pem.Decode([]byte(sWallet.PrivateKeyStr))
-	x509Encoded := block.Bytes
-	privateKey, _ := x509.ParseECPrivateKey(x509Encoded)
 
-	wallet := &Wallet{*privateKey, sWallet.PublicKey}
+	// wallets written before signature schemes existed hold an x509 P-256
+	// key and an unversioned public key
+	if block.Type == "PRIVATE KEY" {
+		privateKey, _ := x509.ParseECPrivateKey(block.Bytes)
+
+		return &Wallet{privateKey.D.FillBytes(make([]byte, 32)), padWalletKey(sWallet.PublicKey), nil}
+	}
+
+	wallet := &Wallet{block.Bytes, padWalletKey(sWallet.PublicKey), nil}
 
 	return wallet
 }
 
+// padWalletKey pads a short legacy key, the wallet's addresses are those
+// of the padded key from then on.
+func padWalletKey(pubKey []byte) []byte {
+	if IsLegacyKey(pubKey) && len(pubKey) < legacyKeyLen {
+		if padded, ok := padLegacyKey(pubKey); ok {
+			return padded
+		}
+	}
+	return pubKey
+}
+
+func walletPEMType(scheme SignatureScheme) string {
+	return strings.ToUpper(scheme.Name()) + " PRIVATE KEY"
+}
+
 func (s_wallet *SerializableWallet) SerializeHelper() []byte {
 	var result bytes.Buffer
 
-	gob.Register(ecdsa.PrivateKey{})
 	encoder := gob.NewEncoder(&result)
 
 	err := encoder.Encode(s_wallet)
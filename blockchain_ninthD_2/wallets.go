@@ -1,34 +1,105 @@
 package main
 
 import "os"
+import "bytes"
+import "errors"
+import "encoding/hex"
 import "fmt"
+import "sort"
+import "sync"
+import "time"
 import "github.com/boltdb/bolt"
 
+const walletsFile = "nfc_wallets"
+const walletsBucket = "wallets"
+const keychainBucket = "keychain"
+const crypterBucket = "crypter"
+const changeBucket = "change"
+
+var errNotOwned = errors.New("the address doesn't belong to this wallet")
+
 type NFC_Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets   map[string]*Wallet
+	Keychain  *Keychain
+	WatchOnly map[string]*WatchedAddress
+	// pubkey hashes, in hex, of the change addresses
+	Change map[string]bool
+	// outpoints kept out of coin selection, see lockunspent
+	LockedUnspent map[string]bool
+	// wallet transactions replaced in the mempool, by txid in hex
+	Replaced map[string]*ReplacedTx
+
+	// nil until encryptwallet
+	crypter *WalletCrypter
+	// locks the wallet again once the unlock timeout expires
+	relock *time.Timer
+	mutex  sync.Mutex
 }
 
 var Nfc_wallets NFC_Wallets
 
+// LoadWallets reads the wallet file, an empty or missing one is an empty
+// wallet.
 func LoadWallets() {
-	walletsFile := "nfc_wallets"
-
 	Nfc_wallets.Wallets = make(map[string]*Wallet)
-	db, _ := bolt.Open(walletsFile, 0600, nil)
+	Nfc_wallets.WatchOnly = make(map[string]*WatchedAddress)
+	Nfc_wallets.Change = make(map[string]bool)
+	Nfc_wallets.LockedUnspent = make(map[string]bool)
+	Nfc_wallets.Replaced = make(map[string]*ReplacedTx)
+
+	db, err := bolt.Open(walletsFile, 0600, nil)
+	if err != nil {
+		fmt.Println("Error is ", err)
+		os.Exit(1)
+	}
+	defer db.Close()
 
 	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte([]byte("wallets")))
+		if b := tx.Bucket([]byte(keychainBucket)); b != nil {
+			Nfc_wallets.Keychain = DeserializeKeychain(b.Get([]byte(keychainBucket)))
+		}
 
-		if b == nil {
-			fmt.Println("none wallet existing in db.\n")
-			os.Exit(1)
-		} else {
+		if b := tx.Bucket([]byte(crypterBucket)); b != nil {
+			Nfc_wallets.crypter = DeserializeWalletCrypter(b.Get([]byte(crypterBucket)))
+		}
+
+		if b := tx.Bucket([]byte(walletsBucket)); b != nil {
 			b.ForEach(func(k, v []byte) error {
 				wallet := DeSerializeWallet(v[:])
-				Nfc_wallets.Wallets[string(k)] = wallet
+				Nfc_wallets.Wallets[wallet.GetAddress()] = wallet
+
+				return nil
+			})
+		}
+
+		if b := tx.Bucket([]byte(changeBucket)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				Nfc_wallets.Change[string(k)] = true
+
+				return nil
+			})
+		}
 
-				// show the address of wallet
-				fmt.Println(string(k))
+		if b := tx.Bucket([]byte(lockedUnspentBucket)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				Nfc_wallets.LockedUnspent[string(k)] = true
+
+				return nil
+			})
+		}
+
+		if b := tx.Bucket([]byte(watchOnlyBucket)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				watched := DeserializeWatchedAddress(v)
+				Nfc_wallets.WatchOnly[watched.Address()] = watched
+
+				return nil
+			})
+		}
+
+		if b := tx.Bucket([]byte(replacedBucket)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				Nfc_wallets.Replaced[hex.EncodeToString(k)] = DeserializeReplacedTx(v)
 
 				return nil
 			})
@@ -37,12 +108,514 @@ func LoadWallets() {
 	})
 }
 
+// Addresses returns the addresses of the wallet, sorted.
+func (wallets *NFC_Wallets) Addresses() []string {
+	addresses := []string{}
+	for address := range wallets.Wallets {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// GetWallet finds the wallet of address, which may be written in any
+// format DecodeAddress reads.
+func (wallets *NFC_Wallets) GetWallet(address string) (*Wallet, bool) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, false
+	}
+
+	pubKeyHash, err := decoded.PubKeyHash()
+	if err != nil {
+		return nil, false
+	}
+
+	wallet, ok := wallets.Wallets[NewPubKeyHashAddress(pubKeyHash).String()]
+
+	return wallet, ok
+}
+
+// walletKey is where wallet is stored in the wallets bucket, it doesn't
+// depend on the network. Files from before bech32 use the base58 address.
+func walletKey(wallet *Wallet) []byte {
+	return []byte(hex.EncodeToString(HashPubKey(wallet.PublicKey)))
+}
+
 func (wallets *NFC_Wallets) GetPubKeyFromAddr(address string) []byte {
-	if wallet, ok := Nfc_wallets.Wallets[address]; ok {
+	if wallet, ok := wallets.GetWallet(address); ok {
 		return wallet.PublicKey
+	}
+
+	if _, ok := wallets.GetWatchedAddress(address); ok {
+		fmt.Println("Error is ", errWatchOnly)
 	} else {
 		fmt.Println("you can't do this transaction.")
-		os.Exit(1)
 	}
+	os.Exit(1)
+
+	return nil
+}
+
+// update runs fn on the wallets file, it is only open while fn runs.
+// Callers change the wallet in memory once it succeeded.
+func (wallets *NFC_Wallets) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(walletsFile, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+// GetSigner returns the signer of an address of the wallet, it fails while
+// the wallet is locked.
+func (wallets *NFC_Wallets) GetSigner(address string) (Signer, error) {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	wallet, ok := wallets.GetWallet(address)
+	if !ok {
+		if _, ok := wallets.GetWatchedAddress(address); ok {
+			return nil, errWatchOnly
+		}
+		return nil, errNotOwned
+	}
+
+	return wallet.Signer()
+}
+
+// SaveWallet stores wallet, encrypting its key first when the wallet file
+// is encrypted, which needs the wallet unlocked.
+func (wallets *NFC_Wallets) SaveWallet(wallet *Wallet) error {
+	if wallets.crypter != nil && wallet.EncryptedKey == nil {
+		if err := wallet.Encrypt(wallets.crypter); err != nil {
+			return err
+		}
+	}
+
+	err := wallets.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(walletsBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(walletKey(wallet), wallet.SerializeWallet())
+	})
+	if err != nil {
+		return err
+	}
+
+	wallets.Wallets[wallet.GetAddress()] = wallet
+
+	return nil
+}
+
+// RemoveWallet deletes the key of address from the wallet file.
+func (wallets *NFC_Wallets) RemoveWallet(address string) error {
+	wallet, ok := wallets.GetWallet(address)
+	if !ok {
+		return errNotOwned
+	}
+
+	err := wallets.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(walletsBucket))
+
+		keys := [][]byte{}
+		b.ForEach(func(k, v []byte) error {
+			if bytes.Equal(DeSerializeWallet(v).PublicKey, wallet.PublicKey) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(wallets.Wallets, wallet.GetAddress())
+
+	return nil
+}
+
+func (wallets *NFC_Wallets) SaveKeychain(keychain *Keychain) error {
+	if wallets.crypter != nil && keychain.EncryptedSeed == nil {
+		if err := keychain.Encrypt(wallets.crypter); err != nil {
+			return err
+		}
+	}
+
+	err := wallets.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(keychainBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(keychainBucket), keychain.Serialize())
+	})
+	if err != nil {
+		return err
+	}
+
+	wallets.Keychain = keychain
+
+	return nil
+}
+
+// InitKeychain makes keychain the wallet's HD keychain and stores the
+// given wallets derived from it, e.g. the ones found by discovery.
+func (wallets *NFC_Wallets) InitKeychain(keychain *Keychain, derived []*Wallet) error {
+	if wallets.Keychain != nil {
+		return errKeychainExists
+	}
+
+	if err := wallets.SaveKeychain(keychain); err != nil {
+		return err
+	}
+	for _, wallet := range derived {
+		if err := wallets.SaveWallet(wallet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewChangeAddress returns a fresh address for change: the next one of
+// the change chain, or a new key when the wallet has no keychain.
+func (wallets *NFC_Wallets) NewChangeAddress() (string, error) {
+	if wallets.Keychain != nil {
+		return wallets.NewAddress(true)
+	}
+
+	wallet := NewWallet()
+	if err := wallets.SaveWallet(wallet); err != nil {
+		return "", err
+	}
+	if err := wallets.markChange(wallet); err != nil {
+		return "", err
+	}
+
+	return wallet.GetAddress(), nil
+}
+
+func (wallets *NFC_Wallets) markChange(wallet *Wallet) error {
+	err := wallets.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(changeBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(walletKey(wallet), []byte{1})
+	})
+	if err != nil {
+		return err
+	}
+
+	wallets.Change[string(walletKey(wallet))] = true
+
 	return nil
 }
+
+// IsChange tells whether pubKeyHash is a change address of the wallet.
+func (wallets *NFC_Wallets) IsChange(pubKeyHash []byte) bool {
+	return wallets.Change[hex.EncodeToString(pubKeyHash)]
+}
+
+// NewAddress derives the next unused address of the external chain, or
+// of the change chain. Indexes without a key are skipped.
+func (wallets *NFC_Wallets) NewAddress(change bool) (string, error) {
+	keychain := wallets.Keychain
+	if keychain == nil {
+		return "", errNoKeychain
+	}
+
+	chain := ExternalChain
+	if change {
+		chain = ChangeChain
+	}
+
+	index := keychain.Next[chain]
+	wallet, err := keychain.DeriveWallet(chain, index)
+	for err == errInvalidChild {
+		index++
+		wallet, err = keychain.DeriveWallet(chain, index)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	keychain.Next[chain] = index + 1
+	if err := wallets.SaveKeychain(keychain); err != nil {
+		return "", err
+	}
+	if err := wallets.SaveWallet(wallet); err != nil {
+		return "", err
+	}
+	if change {
+		if err := wallets.markChange(wallet); err != nil {
+			return "", err
+		}
+	}
+
+	return wallet.GetAddress(), nil
+}
+
+func (wallets *NFC_Wallets) IsEncrypted() bool {
+	return wallets.crypter != nil
+}
+
+func (wallets *NFC_Wallets) IsLocked() bool {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	return wallets.crypter != nil && wallets.crypter.key == nil
+}
+
+// EncryptWallet encrypts every private key and the HD seed with a key
+// derived from passphrase, and leaves the wallet locked.
+func (wallets *NFC_Wallets) EncryptWallet(passphrase string) error {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	if wallets.crypter != nil {
+		return errWalletEncrypted
+	}
+
+	crypter, err := NewWalletCrypter(passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.reencrypt(crypter); err != nil {
+		return err
+	}
+
+	wallets.lock()
+
+	return nil
+}
+
+// ChangePassphrase encrypts the wallet again under newPassphrase, with a
+// fresh salt. The wallet is locked afterwards.
+func (wallets *NFC_Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	if err := wallets.unlock(oldPassphrase); err != nil {
+		return err
+	}
+
+	crypter, err := NewWalletCrypter(newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.reencrypt(crypter); err != nil {
+		return err
+	}
+
+	wallets.lock()
+
+	return nil
+}
+
+// reencrypt seals the unlocked keys with crypter and rewrites the wallet
+// file, so no page of it keeps a key under the old encryption or none.
+func (wallets *NFC_Wallets) reencrypt(crypter *WalletCrypter) error {
+	for _, wallet := range wallets.Wallets {
+		if err := wallet.Encrypt(crypter); err != nil {
+			return err
+		}
+	}
+
+	if wallets.Keychain != nil {
+		if err := wallets.Keychain.Encrypt(crypter); err != nil {
+			return err
+		}
+	}
+
+	wallets.crypter = crypter
+
+	return wallets.rewriteFile()
+}
+
+func (wallets *NFC_Wallets) rewriteFile() error {
+	tmpFile := walletsFile + ".tmp"
+	os.Remove(tmpFile)
+
+	db, err := bolt.Open(tmpFile, 0600, nil)
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(walletsBucket))
+		if err != nil {
+			return err
+		}
+		for _, wallet := range wallets.Wallets {
+			if err := b.Put(walletKey(wallet), wallet.SerializeWallet()); err != nil {
+				return err
+			}
+		}
+
+		if wallets.Keychain != nil {
+			b, err := tx.CreateBucket([]byte(keychainBucket))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(keychainBucket), wallets.Keychain.Serialize()); err != nil {
+				return err
+			}
+		}
+
+		for name, set := range map[string]map[string]bool{changeBucket: wallets.Change, lockedUnspentBucket: wallets.LockedUnspent} {
+			if len(set) == 0 {
+				continue
+			}
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for k := range set {
+				if err := b.Put([]byte(k), []byte{1}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(wallets.WatchOnly) > 0 {
+			b, err := tx.CreateBucket([]byte(watchOnlyBucket))
+			if err != nil {
+				return err
+			}
+			for _, watched := range wallets.WatchOnly {
+				if err := b.Put([]byte(hex.EncodeToString(watched.PubKeyHash)), watched.Serialize()); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(wallets.Replaced) > 0 {
+			b, err := tx.CreateBucket([]byte(replacedBucket))
+			if err != nil {
+				return err
+			}
+			for _, r := range wallets.Replaced {
+				if err := b.Put(r.Tx.ID, r.Serialize()); err != nil {
+					return err
+				}
+			}
+		}
+
+		b, err = tx.CreateBucket([]byte(crypterBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(crypterBucket), wallets.crypter.Serialize())
+	})
+	db.Close()
+
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	return os.Rename(tmpFile, walletsFile)
+}
+
+// Unlock decrypts the keys. They stay in memory only, for timeout when
+// it is positive, or until Lock or the process exits; nothing on disk
+// keeps the wallet unlocked.
+func (wallets *NFC_Wallets) Unlock(passphrase string, timeout time.Duration) error {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	if err := wallets.unlock(passphrase); err != nil {
+		return err
+	}
+
+	if wallets.relock != nil {
+		wallets.relock.Stop()
+		wallets.relock = nil
+	}
+	if timeout > 0 {
+		wallets.relock = time.AfterFunc(timeout, wallets.Lock)
+	}
+
+	return nil
+}
+
+// Lock clears the decrypted keys from memory.
+func (wallets *NFC_Wallets) Lock() {
+	wallets.mutex.Lock()
+	defer wallets.mutex.Unlock()
+
+	if wallets.relock != nil {
+		wallets.relock.Stop()
+		wallets.relock = nil
+	}
+
+	wallets.lock()
+}
+
+func (wallets *NFC_Wallets) unlock(passphrase string) error {
+	if wallets.crypter == nil {
+		return errWalletNotEncrypted
+	}
+
+	key, err := wallets.crypter.DeriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	return wallets.unlockWithKey(key)
+}
+
+func (wallets *NFC_Wallets) unlockWithKey(key []byte) error {
+	if !wallets.crypter.CheckKey(key) {
+		return errWrongPassphrase
+	}
+
+	wallets.crypter.key = key
+
+	for _, wallet := range wallets.Wallets {
+		if err := wallet.Decrypt(wallets.crypter); err != nil {
+			wallets.lock()
+			return err
+		}
+	}
+
+	if wallets.Keychain != nil {
+		if err := wallets.Keychain.Decrypt(wallets.crypter); err != nil {
+			wallets.lock()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (wallets *NFC_Wallets) lock() {
+	for _, wallet := range wallets.Wallets {
+		wallet.Lock()
+	}
+
+	if wallets.Keychain != nil {
+		wallets.Keychain.Lock()
+	}
+
+	if wallets.crypter != nil {
+		wallets.crypter.key = nil
+	}
+}
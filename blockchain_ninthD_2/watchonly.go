@@ -0,0 +1,151 @@
+package main
+
+import "bytes"
+import "errors"
+import "encoding/gob"
+import "encoding/hex"
+import "sort"
+import "github.com/boltdb/bolt"
+
+// watch-only entries are addresses the wallet follows without a key,
+// stored by pubkey hash next to the keys.
+const watchOnlyBucket = "watchonly"
+
+var errWatchOnly = errors.New("the address is watch-only, the wallet can't spend from it")
+var errAlreadyOwned = errors.New("the wallet already holds the key of this address")
+
+type WatchedAddress struct {
+	PubKeyHash []byte
+	Label      string
+}
+
+// Ownership says what the wallet can do with the outputs to an address.
+type Ownership int
+
+const (
+	NotMine Ownership = iota
+	Spendable
+	WatchOnly
+)
+
+func (o Ownership) String() string {
+	switch o {
+	case Spendable:
+		return "spendable"
+	case WatchOnly:
+		return "watch-only"
+	}
+	return "not mine"
+}
+
+func (w *WatchedAddress) Address() string {
+	return NewPubKeyHashAddress(w.PubKeyHash).String()
+}
+
+func (w *WatchedAddress) Serialize() []byte {
+	var result bytes.Buffer
+
+	encoder := gob.NewEncoder(&result)
+
+	_ = encoder.Encode(w)
+
+	return result.Bytes()
+}
+
+func DeserializeWatchedAddress(buffer []byte) *WatchedAddress {
+	var w WatchedAddress
+
+	decoder := gob.NewDecoder(bytes.NewReader(buffer))
+
+	_ = decoder.Decode(&w)
+
+	return &w
+}
+
+// ImportAddress starts watching address.
+func (wallets *NFC_Wallets) ImportAddress(address, label string) (*WatchedAddress, error) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := decoded.PubKeyHash()
+	if err != nil {
+		return nil, err
+	}
+
+	if wallets.Ownership(pubKeyHash) == Spendable {
+		return nil, errAlreadyOwned
+	}
+
+	watched := &WatchedAddress{pubKeyHash, label}
+
+	err = wallets.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(watchOnlyBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(hex.EncodeToString(pubKeyHash)), watched.Serialize())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wallets.WatchOnly[watched.Address()] = watched
+
+	return watched, nil
+}
+
+func (wallets *NFC_Wallets) RemoveWatchedAddress(address string) error {
+	watched, ok := wallets.GetWatchedAddress(address)
+	if !ok {
+		return errNotOwned
+	}
+
+	err := wallets.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(watchOnlyBucket)).Delete([]byte(hex.EncodeToString(watched.PubKeyHash)))
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(wallets.WatchOnly, watched.Address())
+
+	return nil
+}
+
+// WatchedAddresses returns the watch-only addresses, sorted.
+func (wallets *NFC_Wallets) WatchedAddresses() []string {
+	addresses := []string{}
+	for address := range wallets.WatchOnly {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func (wallets *NFC_Wallets) GetWatchedAddress(address string) (*WatchedAddress, bool) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, false
+	}
+
+	watched, ok := wallets.WatchOnly[NewPubKeyHashAddress(decoded.Program).String()]
+
+	return watched, ok
+}
+
+// Ownership tells whether outputs to pubKeyHash are the wallet's.
+func (wallets *NFC_Wallets) Ownership(pubKeyHash []byte) Ownership {
+	address := NewPubKeyHashAddress(pubKeyHash).String()
+
+	if _, ok := wallets.Wallets[address]; ok {
+		return Spendable
+	}
+	if _, ok := wallets.WatchOnly[address]; ok {
+		return WatchOnly
+	}
+	return NotMine
+}